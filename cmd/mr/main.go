@@ -1,27 +1,60 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/pedrogao/plib/pkg/mr"
+	"github.com/pedrogao/plib/pkg/mr/dist"
+)
+
+var (
+	mode    = flag.String("mode", "", "run mode: coordinator, worker, empty runs in-process")
+	addr    = flag.String("addr", "127.0.0.1:0", "coordinator address")
+	workers = flag.Int("workers", 3, "number of worker processes started by coordinator")
+	nReduce = flag.Int("reduce", 4, "number of reduce tasks")
+	outDir  = flag.String("out", ".", "directory of intermediate and output files")
+	timeout = flag.Duration("timeout", 10*time.Second, "task timeout before reassigning")
 )
 
 func main() {
-	val, err := mr.MapReduce(func(source chan<- interface{}) {
+	flag.Parse()
+
+	switch *mode {
+	case "coordinator":
+		runCoordinator(flag.Args())
+	case "worker":
+		if err := dist.Worker(*addr, wordCountMap, wordCountReduce); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		runInProcess()
+	}
+}
+
+func runInProcess() {
+	val, err := mr.MapReduce(func(source chan<- int) {
 		// generator
 		for i := 0; i < 10; i++ {
 			source <- i
 		}
-	}, func(item interface{}, writer mr.Writer, cancel func(error)) {
+	}, func(ctx context.Context, i int, writer mr.Writer[int], cancel func(error)) {
 		// mapper
-		i := item.(int)
 		writer.Write(i * i)
-	}, func(pipe <-chan interface{}, writer mr.Writer, cancel func(error)) {
+	}, func(pipe <-chan int, writer mr.Writer[int], cancel func(error)) {
 		// reducer
 		var sum int
 		for i := range pipe {
-			sum += i.(int)
+			sum += i
 		}
 		writer.Write(sum)
 	})
@@ -30,3 +63,71 @@ func main() {
 	}
 	fmt.Println("result:", val)
 }
+
+// runCoordinator 启动 coordinator，并以子进程的方式启动 worker
+func runCoordinator(files []string) {
+	c, err := dist.NewCoordinator(files, *nReduce, dist.WithOutDir(*outDir), dist.WithTaskTimeout(*timeout))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = c.Serve(*addr); err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		cmd := exec.Command(self, "-mode", "worker", "-addr", c.Addr())
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err = cmd.Start(); err != nil {
+			log.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 崩溃的 worker 手上的任务会在超时后被重新分配
+			if err := cmd.Wait(); err != nil {
+				log.Printf("worker %d exit: %s", cmd.Process.Pid, err)
+			}
+		}()
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-c.Done():
+		<-exited
+	case <-exited:
+		select {
+		case <-c.Done():
+		default:
+			log.Fatal("all workers exited before the job finished")
+		}
+	}
+	for r := 0; r < *nReduce; r++ {
+		fmt.Println(dist.OutputFile(*outDir, r))
+	}
+}
+
+func wordCountMap(filename string, contents string) []dist.KeyValue {
+	words := strings.FieldsFunc(contents, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	kvs := make([]dist.KeyValue, 0, len(words))
+	for _, word := range words {
+		kvs = append(kvs, dist.KeyValue{Key: word, Value: "1"})
+	}
+	return kvs
+}
+
+func wordCountReduce(key string, values []string) string {
+	return strconv.Itoa(len(values))
+}
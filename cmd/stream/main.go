@@ -1,25 +1,78 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/pedrogao/plib/pkg/stream"
 )
 
+var pattern = flag.String("glob", "", "count words of the files matching the pattern, read stdin if empty")
+
+// 统计单词出现的次数，按次数从大到小输出
 func main() {
-	ok := stream.Just(1, 2, 3, 4, 5).
-		Concat(stream.Just(6, 9, 10)).
-		Map(func(item int) int {
-			return item + 100
-		}).
-		Filter(func(item int) bool {
-			return item > 105
-		}).
-		Sort(func(a, b int) bool {
-			return a > b
-		}).
-		AllMatch(func(item int) bool {
-			return item > 105
+	flag.Parse()
+
+	var lines stream.Stream[string]
+	if *pattern != "" {
+		lines = fileLines(stream.Glob(*pattern))
+	} else {
+		lines = stream.Lines(os.Stdin)
+	}
+	words := stream.FlatMap(lines, strings.Fields)
+	counts := stream.Reduce(words, make(map[string]int), func(acc map[string]int, word string) map[string]int {
+		acc[word]++
+		return acc
+	})
+	if err := words.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var keys []string
+	for word := range counts {
+		keys = append(keys, word)
+	}
+	sorted := stream.Just(keys...).Sort(func(a, b string) bool {
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+	output := stream.Map(sorted, func(word string) string {
+		return fmt.Sprintf("%s %d", word, counts[word])
+	}, stream.Ordered())
+	if err := stream.WriteLines(output, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// fileLines 逐行读取所有文件，不会把整个文件读入内存
+func fileLines(paths stream.Stream[string]) stream.Stream[string] {
+	return stream.From(func(source chan<- string) {
+		paths.ForEach(func(path string) {
+			readLines(path, source)
 		})
-	fmt.Println(ok)
+		if err := paths.Err(); err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+func readLines(path string, source chan<- string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := stream.Lines(file)
+	lines.ForEach(func(line string) {
+		source <- line
+	})
+	if err = lines.Err(); err != nil {
+		log.Fatal(err)
+	}
 }
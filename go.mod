@@ -5,7 +5,6 @@ go 1.18
 require (
 	github.com/bytedance/sonic v1.1.1
 	github.com/davecgh/go-spew v1.1.1
-	github.com/gammazero/deque v0.1.0
 	github.com/goccy/go-jit v0.0.0-20200514131505-ff78d45cf6af
 	github.com/json-iterator/go v1.1.12
 	github.com/kaitai-io/kaitai_struct_go_runtime v0.0.0-20220323120020-bcb4c4493cea
@@ -1,28 +1,122 @@
 package actor
 
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pedrogao/plib/pkg/log"
+)
+
 type Actor[Msg any] interface {
+	// Send 发送消息，actor 停止后消息被丢弃
 	Send(msg Msg)
+
+	// Stop 停止 actor，未处理的消息被丢弃，通过 Done 等待 actor 退出
+	Stop()
+
+	// Done actor 退出后被关闭
+	Done() <-chan struct{}
+}
+
+type (
+	// PanicError is the failure reported to the supervisor when the reducer panics.
+	PanicError struct {
+		Value any
+		Stack []byte
+	}
+
+	options[St any] struct {
+		checkpointEvery int
+		clone           func(St) St
+		supervisor      *Supervisor
+	}
+
+	// Option defines the method to customize an actor.
+	Option[St any] func(opts *options[St])
+)
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("actor panic: %v\n%s", e.Value, e.Stack)
+}
+
+// WithCheckpoint saves the state every n messages, a restarted actor continues from
+// the last checkpoint instead of the initial state. clone copies the state, it is
+// required if the reducer mutates the state in place, e.g. maps or pointers.
+func WithCheckpoint[St any](every int, clone func(St) St) Option[St] {
+	return func(opts *options[St]) {
+		opts.checkpointEvery = every
+		opts.clone = clone
+	}
+}
+
+// WithSupervisor lets the supervisor decide whether the actor restarts when it panics,
+// an actor without supervisor always restarts.
+func WithSupervisor[St any](supervisor *Supervisor) Option[St] {
+	return func(opts *options[St]) {
+		opts.supervisor = supervisor
+	}
 }
 
 type reducerActor[Msg, St any] struct {
-	state   St
-	queue   chan Msg
-	reducer func(Msg, St) St
+	initial       St
+	state         St
+	checkpoint    St
+	hasCheckpoint bool
+	processed     int
+	opts          options[St]
+	queue         chan Msg
+	reducer       func(Msg, St) St
+	restartSignal chan struct{} // 监督者要求重启
+	stopSignal    chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
 }
 
 func NewFromReducer[Msg, St any](initial St,
-	reducer func(Msg, St) St) Actor[Msg] {
+	reducer func(Msg, St) St, opts ...Option[St]) Actor[Msg] {
 	ga := &reducerActor[Msg, St]{
-		state:   initial,
-		queue:   make(chan Msg, 1),
-		reducer: reducer,
+		queue:         make(chan Msg, 1),
+		reducer:       reducer,
+		restartSignal: make(chan struct{}, 1),
+		stopSignal:    make(chan struct{}),
+		done:          make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(&ga.opts)
+	}
+	ga.initial = initial
+	ga.state = ga.copy(initial)
 	ga.start()
+	if ga.opts.supervisor != nil {
+		ga.opts.supervisor.add(ga)
+	}
 	return ga
 }
 
 func (r *reducerActor[Msg, _]) Send(msg Msg) {
-	r.queue <- msg
+	select {
+	case <-r.stopSignal:
+		return
+	default:
+	}
+	select {
+	case r.queue <- msg:
+	case <-r.done:
+	}
+}
+
+func (r *reducerActor[_, _]) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopSignal)
+		if r.opts.supervisor != nil {
+			r.opts.supervisor.remove(r)
+		}
+	})
+}
+
+func (r *reducerActor[_, _]) Done() <-chan struct{} {
+	return r.done
 }
 
 func (r *reducerActor[_, _]) start() {
@@ -30,20 +124,91 @@ func (r *reducerActor[_, _]) start() {
 }
 
 func (r *reducerActor[_, _]) receiveLoop() {
-	for msg := range r.queue {
-		r.state = r.reducer(msg, r.state)
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stopSignal:
+			return
+		case <-r.restartSignal:
+			r.restart()
+		case msg := <-r.queue:
+			// 停止和重启请求先于消息生效
+			select {
+			case <-r.stopSignal:
+				return
+			case <-r.restartSignal:
+				r.restart()
+			default:
+			}
+			if err := r.receive(msg); err != nil && !r.recover(err) {
+				return
+			}
+		}
 	}
 }
 
+// receive 处理消息，reducer panic 时返回 PanicError，状态保持不变
+func (r *reducerActor[Msg, _]) receive(msg Msg) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	r.state = r.reducer(msg, r.state)
+	r.processed++
+	if r.opts.checkpointEvery > 0 && r.processed%r.opts.checkpointEvery == 0 {
+		r.checkpoint = r.copy(r.state)
+		r.hasCheckpoint = true
+	}
+	return nil
+}
+
+// recover 处理失败，返回 false 时 actor 退出
+func (r *reducerActor[_, _]) recover(err error) bool {
+	if r.opts.supervisor == nil {
+		log.Error("actor restarts after failure: ", err)
+	} else if !r.opts.supervisor.failed(r, err) {
+		return false
+	}
+	r.restart()
+	return true
+}
+
+// restart 从最近的检查点或者初始状态重新开始
+func (r *reducerActor[_, _]) restart() {
+	if r.hasCheckpoint {
+		r.state = r.copy(r.checkpoint)
+	} else {
+		r.state = r.copy(r.initial)
+	}
+}
+
+// requestRestart 由监督者调用，在处理下一条消息前重启
+func (r *reducerActor[_, _]) requestRestart() {
+	select {
+	case r.restartSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (r *reducerActor[_, St]) copy(state St) St {
+	if r.opts.clone != nil {
+		return r.opts.clone(state)
+	}
+	return state
+}
+
 type Message[St any] interface {
 	Apply(St) St
 }
 
-func NewTyped[St any](initial St) Actor[Message[St]] {
+func NewTyped[St any](initial St, opts ...Option[St]) Actor[Message[St]] {
 	return NewFromReducer(initial,
 		func(msg Message[St], state St) St {
 			return msg.Apply(state)
 		},
+		opts...,
 	)
 }
 
@@ -68,8 +233,15 @@ func GetAsync[St, Ret any](a Actor[Message[St]],
 	return reply
 }
 
-// Get applies the projection func to the actor's state and returns the result
+// Get applies the projection func to the actor's state and returns the result,
+// it returns the zero value if the actor stops before replying
 func Get[St, Ret any](a Actor[Message[St]], projection func(St) Ret) Ret {
 	reply := GetAsync(a, projection)
-	return <-reply
+	select {
+	case ret := <-reply:
+		return ret
+	case <-a.Done():
+		var zero Ret
+		return zero
+	}
 }
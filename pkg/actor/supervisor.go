@@ -0,0 +1,208 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTooManyRestarts is the error of a supervisor which gave up restarting its children.
+var ErrTooManyRestarts = errors.New("too many restarts")
+
+// Strategy 重启策略
+type Strategy int
+
+const (
+	// OneForOne 只重启失败的 actor
+	OneForOne Strategy = iota
+	// OneForAll 重启所有的 actor
+	OneForAll
+)
+
+type (
+	// child 被监督者，actor 或者下级监督者
+	child interface {
+		requestRestart()
+		Stop()
+		Done() <-chan struct{}
+	}
+
+	// Supervisor restarts the actors it supervises when they panic, supervisors form
+	// a tree: a supervisor which exceeds its max restarts escalates to its parent.
+	Supervisor struct {
+		strategy    Strategy
+		maxRestarts int
+		window      time.Duration
+		parent      *Supervisor
+
+		mu       sync.Mutex
+		children map[child]struct{}
+		restarts []time.Time // 窗口内的重启时间
+		stopped  bool
+		err      error
+		stopOnce sync.Once
+		done     chan struct{}
+	}
+
+	// SupervisorOption defines the method to customize a supervisor.
+	SupervisorOption func(s *Supervisor)
+)
+
+// WithMaxRestarts limits the restarts to n within the window, the supervisor stops
+// all its children, or escalates to its parent, when the limit is exceeded.
+func WithMaxRestarts(n int, window time.Duration) SupervisorOption {
+	return func(s *Supervisor) {
+		s.maxRestarts = n
+		s.window = window
+	}
+}
+
+// WithParent supervises the supervisor by the parent.
+func WithParent(parent *Supervisor) SupervisorOption {
+	return func(s *Supervisor) {
+		s.parent = parent
+	}
+}
+
+// NewSupervisor creates a supervisor with the restart strategy
+func NewSupervisor(strategy Strategy, opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		strategy: strategy,
+		children: make(map[child]struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.parent != nil {
+		s.parent.add(s)
+	}
+	return s
+}
+
+// Stop 停止监督者以及所有被监督者，通过 Done 等待退出
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.stopped = true
+		children := make([]child, 0, len(s.children))
+		for c := range s.children {
+			children = append(children, c)
+		}
+		s.mu.Unlock()
+
+		for _, c := range children {
+			c.Stop()
+		}
+		if s.parent != nil {
+			s.parent.remove(s)
+		}
+		go func() {
+			for _, c := range children {
+				<-c.Done()
+			}
+			close(s.done)
+		}()
+	})
+}
+
+// Done 监督者以及所有被监督者退出后被关闭
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回监督者放弃重启的原因
+func (s *Supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Supervisor) add(c child) {
+	s.mu.Lock()
+	stopped := s.stopped
+	if !stopped {
+		s.children[c] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	if stopped {
+		c.Stop()
+	}
+}
+
+func (s *Supervisor) remove(c child) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.children, c)
+}
+
+// failed 被监督者失败，返回 true 时被监督者重启，否则退出
+func (s *Supervisor) failed(c child, err error) bool {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return false
+	}
+
+	if !s.allowRestart(time.Now()) {
+		s.mu.Unlock()
+		// 上报给上级监督者，上级允许时重启所有被监督者
+		if s.parent != nil && s.parent.failed(s, err) {
+			s.mu.Lock()
+			s.restarts = nil
+			s.restartChildren(c)
+			s.mu.Unlock()
+			return true
+		}
+		s.mu.Lock()
+		s.err = fmt.Errorf("%w: %v", ErrTooManyRestarts, err)
+		s.mu.Unlock()
+		s.Stop()
+		return false
+	}
+
+	if s.strategy == OneForAll {
+		s.restartChildren(c)
+	}
+	s.mu.Unlock()
+	return true
+}
+
+// allowRestart 记录一次重启，超过窗口内最大重启次数时返回 false，s.mu must be held
+func (s *Supervisor) allowRestart(now time.Time) bool {
+	if s.maxRestarts <= 0 {
+		return true
+	}
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.window {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+	if len(s.restarts) >= s.maxRestarts {
+		return false
+	}
+	s.restarts = append(s.restarts, now)
+	return true
+}
+
+// restartChildren 重启除 except 以外的被监督者，except 自行重启，s.mu must be held
+func (s *Supervisor) restartChildren(except child) {
+	for c := range s.children {
+		if c != except {
+			c.requestRestart()
+		}
+	}
+}
+
+// requestRestart 上级监督者要求重启所有被监督者
+func (s *Supervisor) requestRestart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restarts = nil
+	s.restartChildren(nil)
+}
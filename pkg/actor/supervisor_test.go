@@ -0,0 +1,155 @@
+package actor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	incr  int
+	boom  struct{}
+	query struct{ reply chan int }
+)
+
+func counter(opts ...Option[int]) Actor[any] {
+	return NewFromReducer(0, func(raw any, sum int) int {
+		switch msg := raw.(type) {
+		case incr:
+			return sum + int(msg)
+		case boom:
+			panic("boom")
+		case query:
+			msg.reply <- sum
+		}
+		return sum
+	}, opts...)
+}
+
+func value(a Actor[any]) int {
+	reply := make(chan int, 1)
+	a.Send(query{reply: reply})
+	return <-reply
+}
+
+func TestStop(t *testing.T) {
+	assert := assert.New(t)
+
+	a := counter()
+	a.Send(incr(1))
+	assert.Equal(1, value(a))
+
+	a.Stop()
+	a.Stop()
+	<-a.Done()
+	a.Send(incr(1)) // 不会阻塞
+
+	typed := NewTyped(0)
+	typed.Stop()
+	assert.Equal(0, Get(typed, func(st int) int { return st + 1 }))
+}
+
+func TestPanicRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	a := counter()
+	defer a.Stop()
+	a.Send(incr(2))
+	a.Send(boom{})
+	assert.Equal(0, value(a))
+	a.Send(incr(3))
+	assert.Equal(3, value(a))
+}
+
+func TestCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	a := counter(WithCheckpoint[int](2, nil))
+	defer a.Stop()
+	a.Send(incr(1))
+	a.Send(incr(2)) // checkpoint: 3
+	a.Send(incr(4))
+	a.Send(boom{})
+	assert.Equal(3, value(a))
+}
+
+func TestOneForOne(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewSupervisor(OneForOne)
+	a := counter(WithSupervisor[int](s))
+	b := counter(WithSupervisor[int](s))
+	a.Send(incr(1))
+	b.Send(incr(1))
+	a.Send(boom{})
+	assert.Equal(0, value(a))
+	assert.Equal(1, value(b))
+
+	s.Stop()
+	<-s.Done()
+	<-a.Done()
+	<-b.Done()
+	assert.NoError(s.Err())
+}
+
+func TestOneForAll(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewSupervisor(OneForAll)
+	defer s.Stop()
+	a := counter(WithSupervisor[int](s))
+	b := counter(WithSupervisor[int](s))
+	b.Send(incr(1))
+	assert.Equal(1, value(b))
+	a.Send(boom{})
+	assert.Equal(0, value(a))
+	assert.Equal(0, value(b))
+}
+
+func TestMaxRestarts(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewSupervisor(OneForOne, WithMaxRestarts(2, time.Minute))
+	a := counter(WithSupervisor[int](s))
+	b := counter(WithSupervisor[int](s))
+	a.Send(boom{})
+	a.Send(boom{})
+	assert.Equal(0, value(a))
+	a.Send(boom{})
+
+	<-s.Done()
+	<-a.Done()
+	<-b.Done()
+	assert.True(errors.Is(s.Err(), ErrTooManyRestarts))
+}
+
+func TestSupervisorTree(t *testing.T) {
+	assert := assert.New(t)
+
+	root := NewSupervisor(OneForOne, WithMaxRestarts(1, time.Minute))
+	sub := NewSupervisor(OneForAll, WithParent(root), WithMaxRestarts(1, time.Minute))
+	a := counter(WithSupervisor[int](sub))
+	b := counter(WithSupervisor[int](sub))
+
+	b.Send(incr(1))
+	assert.Equal(1, value(b))
+	a.Send(boom{}) // sub 重启
+	assert.Equal(0, value(a))
+	assert.Equal(0, value(b))
+	b.Send(incr(1))
+	assert.Equal(1, value(b))
+	a.Send(boom{}) // sub 超过限制，上报 root 重启
+	assert.Equal(0, value(a))
+	assert.Equal(0, value(b))
+	assert.NoError(sub.Err())
+
+	a.Send(boom{}) // sub 重启
+	a.Send(boom{}) // root 超过限制，全部停止
+	<-root.Done()
+	<-sub.Done()
+	<-a.Done()
+	<-b.Done()
+	assert.True(errors.Is(root.Err(), ErrTooManyRestarts))
+}
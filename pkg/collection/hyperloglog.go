@@ -0,0 +1,97 @@
+package collection
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+const (
+	minPrecision = 4
+	maxPrecision = 16
+)
+
+// HyperLogLog 基数估计，使用 2^precision 个寄存器，标准误差约为 1.04/sqrt(2^precision)
+// refer to https://en.wikipedia.org/wiki/HyperLogLog
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog 新建 HyperLogLog，precision 的范围是 [4, 16]
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < minPrecision {
+		precision = minPrecision
+	} else if precision > maxPrecision {
+		precision = maxPrecision
+	}
+	return &HyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+func (h *HyperLogLog) Add(item string) {
+	x := hash64([]byte(item))
+	// 高 precision 位作为寄存器下标，剩余的位计算前导零，
+	// 末尾补一个 1 保证前导零的数量不超过剩余的位数
+	index := x >> (64 - h.precision)
+	w := x<<h.precision | 1<<(h.precision-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Count 返回估计的基数
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := h.alpha() * m * m / sum
+	// 基数较小时使用线性计数
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge 合并另一个相同精度的 HyperLogLog
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.precision != other.precision {
+		return fmt.Errorf("precision mismatch: %d != %d", h.precision, other.precision)
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+func (h *HyperLogLog) alpha() float64 {
+	switch m := len(h.registers); m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 由两个不同种子的 murmur3 拼成 64 位
+func hash64(data []byte) uint64 {
+	return uint64(hash.Murmur332(data, 0))<<32 | uint64(hash.Murmur332(data, hash.DefaultSeed))
+}
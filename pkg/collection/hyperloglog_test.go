@@ -0,0 +1,42 @@
+package collection
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewHyperLogLog(14)
+	assert.Equal(uint64(0), h.Count())
+	for _, n := range []int{10, 1000, 100000} {
+		h = NewHyperLogLog(14)
+		for i := 0; i < n; i++ {
+			// 重复的元素不影响基数
+			h.Add(strconv.Itoa(i))
+			h.Add(strconv.Itoa(i))
+		}
+		assert.InEpsilon(n, h.Count(), 0.03)
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := NewHyperLogLog(12), NewHyperLogLog(12)
+	for i := 0; i < 5000; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 2500))
+	}
+	assert.Nil(a.Merge(b))
+	assert.InEpsilon(7500, a.Count(), 0.05)
+	assert.NotNil(a.Merge(NewHyperLogLog(10)))
+
+	// 精度被限制在 [4, 16]
+	assert.Len(NewHyperLogLog(1).registers, 1<<minPrecision)
+	assert.Len(NewHyperLogLog(math.MaxUint8).registers, 1<<maxPrecision)
+}
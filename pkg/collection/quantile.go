@@ -0,0 +1,101 @@
+package collection
+
+import (
+	"math"
+	"sort"
+)
+
+const minQuantileSize = 8
+
+type (
+	// QuantileSketch 流式分位数估计，参考 KLL，每一层最多保存 size 个值，
+	// 某一层满了之后排序，隔一个取一个，以两倍的权重放入上一层，
+	// 内存为 O(size * log(n/size))
+	// refer to https://arxiv.org/abs/1603.05346
+	QuantileSketch struct {
+		size   int
+		levels [][]float64
+		count  int
+		offset int
+	}
+
+	weightedValue struct {
+		value  float64
+		weight int
+	}
+)
+
+// NewQuantileSketch 新建分位数估计，size 越大越精确
+func NewQuantileSketch(size int) *QuantileSketch {
+	if size < minQuantileSize {
+		size = minQuantileSize
+	}
+	return &QuantileSketch{
+		size:   size,
+		levels: [][]float64{nil},
+	}
+}
+
+func (q *QuantileSketch) Add(value float64) {
+	q.levels[0] = append(q.levels[0], value)
+	q.count++
+	for i := 0; i < len(q.levels) && len(q.levels[i]) >= q.size; i++ {
+		q.compact(i)
+	}
+}
+
+// Count 返回加入的值的个数
+func (q *QuantileSketch) Count() int {
+	return q.count
+}
+
+// Quantile 返回分位数 phi 的估计值，phi 的范围是 [0, 1]，没有值时返回 NaN
+func (q *QuantileSketch) Quantile(phi float64) float64 {
+	if q.count == 0 {
+		return math.NaN()
+	}
+
+	var values []weightedValue
+	total := 0
+	for i, level := range q.levels {
+		for _, v := range level {
+			values = append(values, weightedValue{value: v, weight: 1 << i})
+			total += 1 << i
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].value < values[j].value
+	})
+
+	target := math.Max(0, math.Min(1, phi)) * float64(total)
+	cumulative := 0
+	for _, v := range values {
+		cumulative += v.weight
+		if float64(cumulative) >= target {
+			return v.value
+		}
+	}
+	return values[len(values)-1].value
+}
+
+// compact 将第 i 层的一半值以两倍的权重放入第 i+1 层
+func (q *QuantileSketch) compact(i int) {
+	if i+1 == len(q.levels) {
+		q.levels = append(q.levels, nil)
+	}
+
+	level := q.levels[i]
+	sort.Float64s(level)
+	// 奇数个时最后一个值留在本层
+	var rest []float64
+	if len(level)%2 == 1 {
+		rest = append(rest, level[len(level)-1])
+		level = level[:len(level)-1]
+	}
+	// 交替选择奇偶位置，避免估计值系统性地偏大或偏小
+	for j := q.offset; j < len(level); j += 2 {
+		q.levels[i+1] = append(q.levels[i+1], level[j])
+	}
+	q.offset ^= 1
+	q.levels[i] = append(level[:0], rest...)
+}
@@ -0,0 +1,49 @@
+package collection
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantileSketch(t *testing.T) {
+	assert := assert.New(t)
+
+	q := NewQuantileSketch(128)
+	assert.True(math.IsNaN(q.Quantile(0.5)))
+
+	n := 100000
+	for _, i := range rand.Perm(n) {
+		q.Add(float64(i))
+	}
+	assert.Equal(n, q.Count())
+	for _, phi := range []float64{0.1, 0.5, 0.9, 0.99} {
+		// 排名误差在 2% 以内
+		assert.InDelta(phi*float64(n), q.Quantile(phi), 0.02*float64(n))
+	}
+	assert.InDelta(0, q.Quantile(0), 0.02*float64(n))
+	assert.InDelta(n, q.Quantile(1), 0.02*float64(n))
+
+	// 内存有界
+	size := 0
+	for _, level := range q.levels {
+		size += len(level)
+	}
+	assert.Less(size, 128*len(q.levels))
+	assert.Less(len(q.levels), 20)
+}
+
+func TestQuantileSketchSmall(t *testing.T) {
+	assert := assert.New(t)
+
+	q := NewQuantileSketch(0)
+	for _, v := range []float64{5, 1, 3, 2, 4} {
+		q.Add(v)
+	}
+	// 没有压缩时是精确的
+	assert.Equal(1.0, q.Quantile(0))
+	assert.Equal(3.0, q.Quantile(0.5))
+	assert.Equal(5.0, q.Quantile(1))
+}
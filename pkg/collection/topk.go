@@ -0,0 +1,112 @@
+package collection
+
+import (
+	"container/heap"
+	"sort"
+)
+
+type (
+	// TopKItem 出现次数的估计，真实次数在 [Count-Error, Count] 之间
+	TopKItem struct {
+		Key   string
+		Count int
+		Error int
+	}
+
+	// TopK 使用 Space-Saving 算法估计出现次数最多的 key，最多记录 capacity 个 key，
+	// 计数器满了之后，新的 key 替换计数最小的 key 并继承它的计数
+	// refer to https://www.cs.ucsb.edu/sites/default/files/documents/2005-23.pdf
+	TopK struct {
+		capacity int
+		entries  map[string]*topKEntry
+		heap     topKHeap
+	}
+
+	topKEntry struct {
+		TopKItem
+		index int
+	}
+
+	// topKHeap 计数最小的在堆顶
+	topKHeap []*topKEntry
+)
+
+// NewTopK 新建 TopK，capacity 越大越精确
+func NewTopK(capacity int) *TopK {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TopK{
+		capacity: capacity,
+		entries:  make(map[string]*topKEntry),
+	}
+}
+
+func (t *TopK) Add(key string) {
+	if entry, ok := t.entries[key]; ok {
+		entry.Count++
+		heap.Fix(&t.heap, entry.index)
+		return
+	}
+
+	if len(t.heap) < t.capacity {
+		entry := &topKEntry{TopKItem: TopKItem{Key: key, Count: 1}}
+		t.entries[key] = entry
+		heap.Push(&t.heap, entry)
+		return
+	}
+
+	min := t.heap[0]
+	delete(t.entries, min.Key)
+	min.Key = key
+	min.Error = min.Count
+	min.Count++
+	t.entries[key] = min
+	heap.Fix(&t.heap, 0)
+}
+
+// Top 返回计数最大的 n 个 key，按计数从大到小排列
+func (t *TopK) Top(n int) []TopKItem {
+	items := make([]TopKItem, 0, len(t.heap))
+	for _, entry := range t.heap {
+		items = append(items, entry.TopKItem)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	if n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
+
+func (h topKHeap) Len() int {
+	return len(h)
+}
+
+func (h topKHeap) Less(i, j int) bool {
+	return h[i].Count < h[j].Count
+}
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x any) {
+	entry := x.(*topKEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *topKHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
@@ -0,0 +1,46 @@
+package collection
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopK(t *testing.T) {
+	assert := assert.New(t)
+
+	topK := NewTopK(10)
+	// 少量的 key 出现很多次，大量的 key 只出现一次
+	for i := 0; i < 1000; i++ {
+		topK.Add("a")
+		if i%2 == 0 {
+			topK.Add("b")
+		}
+		if i%4 == 0 {
+			topK.Add("c")
+		}
+		topK.Add(strconv.Itoa(i))
+	}
+
+	top := topK.Top(3)
+	assert.Len(top, 3)
+	assert.Equal([]string{"a", "b", "c"}, []string{top[0].Key, top[1].Key, top[2].Key})
+	for i, count := range []int{1000, 500, 250} {
+		assert.GreaterOrEqual(top[i].Count, count)
+		assert.LessOrEqual(top[i].Count-top[i].Error, count)
+	}
+	assert.Len(topK.Top(100), 10)
+}
+
+func TestTopKExact(t *testing.T) {
+	assert := assert.New(t)
+
+	topK := NewTopK(0)
+	topK.Add("a")
+	topK.Add("a")
+	assert.Equal([]TopKItem{{Key: "a", Count: 2}}, topK.Top(1))
+	// 新的 key 继承最小的计数
+	topK.Add("b")
+	assert.Equal([]TopKItem{{Key: "b", Count: 3, Error: 2}}, topK.Top(1))
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/binary"
 )
 
+// DefaultSeed is the seed of Murmur332 used across the packages, keys hash to
+// the same values wherever they are partitioned.
+const DefaultSeed = 0x9747b28c
+
 // MurmurHash
 // refer:
 //   - https://en.wikipedia.org/wiki/MurmurHash
@@ -34,7 +38,7 @@ func Murmur332(key []byte, seed uint32) uint32 {
 	k = 0
 	for i := length & 3; i > 0; i-- {
 		k <<= 8
-		k |= uint32(key[i-1])
+		k |= uint32(key[offset+i-1])
 	}
 	// A swap is *not* necessary here because the preceding loop already
 	// places the low bytes in the low places according to whatever endianness
@@ -20,7 +20,7 @@ func TestMurmur332(t *testing.T) {
 				key:  []byte("pedro"),
 				seed: 1,
 			},
-			want: 3591849244,
+			want: 236065880,
 		},
 		{
 			name: "2",
@@ -28,7 +28,7 @@ func TestMurmur332(t *testing.T) {
 				key:  []byte("pedro"),
 				seed: 2,
 			},
-			want: 4262892875,
+			want: 2484843035,
 		},
 		{
 			name: "3",
@@ -36,7 +36,7 @@ func TestMurmur332(t *testing.T) {
 				key:  []byte("pedro"),
 				seed: 3,
 			},
-			want: 1556225608,
+			want: 980252078,
 		},
 	}
 	for _, tt := range tests {
@@ -47,3 +47,32 @@ func TestMurmur332(t *testing.T) {
 		})
 	}
 }
+
+// 参考实现 MurmurHash3_x86_32 的输出，覆盖长度为 0~3 的尾部
+func TestMurmur332Reference(t *testing.T) {
+	tests := []struct {
+		key  string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"", 0xffffffff, 0x81f16f39},
+		{"\xff\xff\xff\xff", 0, 0x76293b50},
+		{"!Ce\x87", 0, 0xf55b516b},
+		{"!Ce", 0, 0x7e4a8634},
+		{"!C", 0, 0xa0f7b07a},
+		{"!", 0, 0x72661cf4},
+		{"a", 0x9747b28c, 0x7fa09ea6},
+		{"ab", 0x9747b28c, 0x74875592},
+		{"abc", 0x9747b28c, 0xc84a62dd},
+		{"abcd", 0x9747b28c, 0xf0478627},
+		{"Hello, world!", 1234, 0xfaf6cdb3},
+		{"The quick brown fox jumps over the lazy dog", 0x9747b28c, 0x2fa826cd},
+	}
+	for _, tt := range tests {
+		if got := Murmur332([]byte(tt.key), tt.seed); got != tt.want {
+			t.Errorf("Murmur332(%q, %#x) = %#x, want %#x", tt.key, tt.seed, got, tt.want)
+		}
+	}
+}
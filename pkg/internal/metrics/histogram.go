@@ -0,0 +1,106 @@
+// Package metrics provides the lock-free latency histogram shared by the
+// worker pool statistics and the stream observer.
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets 延迟直方图的上界，最后还有一个 +Inf 桶
+var latencyBuckets = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type (
+	// HistogramStats is the snapshot of a latency histogram.
+	HistogramStats struct {
+		Count   int64         `json:"count"`
+		Mean    time.Duration `json:"mean"`
+		P50     time.Duration `json:"p50"`
+		P99     time.Duration `json:"p99"`
+		Max     time.Duration `json:"max"`
+		Buckets []Bucket      `json:"buckets"`
+	}
+
+	// Bucket is a bucket of the histogram, Le of the last bucket is 0 which means +Inf.
+	Bucket struct {
+		Le    time.Duration `json:"le"`
+		Count int64         `json:"count"`
+	}
+
+	// Histogram is a latency histogram safe for concurrent use, the zero value is ready to use.
+	Histogram struct {
+		buckets [len(latencyBuckets) + 1]int64
+		count   int64
+		sum     int64
+		max     int64
+	}
+)
+
+// Observe records a latency
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	StoreMax(&h.max, int64(d))
+}
+
+// Stats returns the snapshot of the histogram
+func (h *Histogram) Stats() HistogramStats {
+	stats := HistogramStats{
+		Count:   atomic.LoadInt64(&h.count),
+		Max:     time.Duration(atomic.LoadInt64(&h.max)),
+		Buckets: make([]Bucket, len(h.buckets)),
+	}
+	for i := range h.buckets {
+		stats.Buckets[i].Count = atomic.LoadInt64(&h.buckets[i])
+		if i < len(latencyBuckets) {
+			stats.Buckets[i].Le = latencyBuckets[i]
+		}
+	}
+	if stats.Count > 0 {
+		stats.Mean = time.Duration(atomic.LoadInt64(&h.sum) / stats.Count)
+		stats.P50 = stats.quantile(0.5)
+		stats.P99 = stats.quantile(0.99)
+	}
+	return stats
+}
+
+// quantile 返回分位数所在桶的上界，不超过最大值
+func (h HistogramStats) quantile(q float64) time.Duration {
+	target := int64(math.Ceil(q * float64(h.Count)))
+	var cumulative int64
+	for _, b := range h.Buckets {
+		cumulative += b.Count
+		if cumulative >= target && b.Le > 0 && b.Le < h.Max {
+			return b.Le
+		}
+		if cumulative >= target {
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+// StoreMax stores v to addr if it is greater than the current value
+func StoreMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	assert := assert.New(t)
+
+	var h Histogram
+	assert.Equal(int64(0), h.Stats().Count)
+
+	for i := 0; i < 99; i++ {
+		h.Observe(500 * time.Microsecond)
+	}
+	h.Observe(50 * time.Millisecond)
+
+	stats := h.Stats()
+	assert.Equal(int64(100), stats.Count)
+	assert.Equal(50*time.Millisecond, stats.Max)
+	assert.Equal(time.Millisecond, stats.P50)
+	assert.Equal(time.Millisecond, stats.P99)
+	assert.Equal(len(latencyBuckets)+1, len(stats.Buckets))
+	assert.Equal(int64(99), stats.Buckets[3].Count)
+	assert.Equal(int64(1), stats.Buckets[5].Count)
+	assert.Equal(time.Duration(0), stats.Buckets[len(latencyBuckets)].Le)
+}
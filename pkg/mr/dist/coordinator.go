@@ -0,0 +1,262 @@
+package dist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultTaskTimeout = 10 * time.Second
+
+type (
+	taskState int
+
+	task struct {
+		state   taskState
+		attempt int
+		started time.Time
+	}
+
+	options struct {
+		taskTimeout time.Duration
+		outDir      string
+	}
+
+	// Option defines the method to customize the coordinator.
+	Option func(opts *options)
+
+	// Coordinator hands out map and reduce tasks to workers over net/rpc.
+	// Tasks that are not reported within the task timeout are considered
+	// lost (the worker crashed or is too slow) and handed out again.
+	Coordinator struct {
+		lock        sync.Mutex
+		files       []string
+		nReduce     int
+		outDir      string
+		taskTimeout time.Duration
+		maps        []*task
+		reduces     []*task
+		listener    net.Listener
+		done        chan struct{}
+	}
+
+	// coordinatorRPC only exposes the rpc methods of Coordinator
+	coordinatorRPC struct {
+		c *Coordinator
+	}
+)
+
+const (
+	idle taskState = iota
+	running
+	finished
+)
+
+// WithTaskTimeout customizes how long a task may run before it is reassigned.
+func WithTaskTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.taskTimeout = timeout
+	}
+}
+
+// WithOutDir customizes the directory of intermediate and output files.
+func WithOutDir(dir string) Option {
+	return func(opts *options) {
+		opts.outDir = dir
+	}
+}
+
+// NewCoordinator creates a coordinator for files with nReduce reduce tasks.
+func NewCoordinator(files []string, nReduce int, opts ...Option) (*Coordinator, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no input files")
+	}
+	if nReduce < 1 {
+		return nil, fmt.Errorf("nReduce: %d should be greater than 0", nReduce)
+	}
+
+	ops := options{
+		taskTimeout: defaultTaskTimeout,
+		outDir:      ".",
+	}
+	for _, opt := range opts {
+		opt(&ops)
+	}
+	if err := os.MkdirAll(ops.outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("make out dir err: %s", err)
+	}
+
+	c := &Coordinator{
+		files:       files,
+		nReduce:     nReduce,
+		outDir:      ops.outDir,
+		taskTimeout: ops.taskTimeout,
+		maps:        newTasks(len(files)),
+		reduces:     newTasks(nReduce),
+		done:        make(chan struct{}),
+	}
+	return c, nil
+}
+
+// Serve starts serving rpc requests on addr, e.g. 127.0.0.1:0.
+func (c *Coordinator) Serve(addr string) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(rpcName, &coordinatorRPC{c: c}); err != nil {
+		return fmt.Errorf("register rpc err: %s", err)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen %s err: %s", addr, err)
+	}
+
+	c.lock.Lock()
+	c.listener = listener
+	c.lock.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				// listener 已关闭
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the coordinator is listening on.
+func (c *Coordinator) Addr() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.listener == nil {
+		return ""
+	}
+	return c.listener.Addr().String()
+}
+
+// Done returns a channel that is closed when all tasks are finished.
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close stops serving rpc requests.
+func (c *Coordinator) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.listener == nil {
+		return nil
+	}
+	return c.listener.Close()
+}
+
+// RequestTask assigns a task to the worker.
+func (r *coordinatorRPC) RequestTask(args *TaskArgs, reply *TaskReply) error {
+	c := r.c
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	reply.NMap = len(c.files)
+	reply.NReduce = c.nReduce
+	reply.OutDir = c.outDir
+
+	// 所有 map 任务完成之后才能开始 reduce
+	if !allFinished(c.maps) {
+		if id, ok := c.assign(c.maps); ok {
+			reply.Type = MapTask
+			reply.ID = id
+			reply.Attempt = c.maps[id].attempt
+			reply.File = c.files[id]
+		} else {
+			reply.Type = WaitTask
+		}
+		return nil
+	}
+	if !allFinished(c.reduces) {
+		if id, ok := c.assign(c.reduces); ok {
+			reply.Type = ReduceTask
+			reply.ID = id
+			reply.Attempt = c.reduces[id].attempt
+		} else {
+			reply.Type = WaitTask
+		}
+		return nil
+	}
+
+	reply.Type = ExitTask
+	return nil
+}
+
+// ReportTask marks a task as finished.
+func (r *coordinatorRPC) ReportTask(args *ReportArgs, reply *ReportReply) error {
+	c := r.c
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var tasks []*task
+	switch args.Type {
+	case MapTask:
+		tasks = c.maps
+	case ReduceTask:
+		tasks = c.reduces
+	default:
+		return fmt.Errorf("unknown task type: %d", args.Type)
+	}
+	if args.ID < 0 || args.ID >= len(tasks) {
+		return fmt.Errorf("unknown task id: %d", args.ID)
+	}
+
+	// 超时的任务会被重新分配，只接受最新一次分配的结果，
+	// 过期的执行即使晚些上报也会被丢弃
+	t := tasks[args.ID]
+	if args.Attempt != t.attempt {
+		return nil
+	}
+	t.state = finished
+	if allFinished(c.maps) && allFinished(c.reduces) {
+		select {
+		case <-c.done:
+		default:
+			close(c.done)
+		}
+	}
+	return nil
+}
+
+// assign 找到一个空闲或超时的任务，调用方需持有锁
+func (c *Coordinator) assign(tasks []*task) (int, bool) {
+	now := time.Now()
+	for id, t := range tasks {
+		if t.state == idle || (t.state == running && now.Sub(t.started) > c.taskTimeout) {
+			t.state = running
+			t.attempt++
+			t.started = now
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func newTasks(n int) []*task {
+	tasks := make([]*task, n)
+	for i := range tasks {
+		tasks[i] = &task{}
+	}
+	return tasks
+}
+
+func allFinished(tasks []*task) bool {
+	for _, t := range tasks {
+		if t.state != finished {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package dist
+
+import (
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func wordCountMap(filename string, contents string) []KeyValue {
+	var kvs []KeyValue
+	for _, word := range strings.Fields(contents) {
+		kvs = append(kvs, KeyValue{Key: word, Value: "1"})
+	}
+	return kvs
+}
+
+func wordCountReduce(key string, values []string) string {
+	return strconv.Itoa(len(values))
+}
+
+func writeInputs(t *testing.T, dir string, contents ...string) []string {
+	var files []string
+	for i, content := range contents {
+		file := filepath.Join(dir, "input-"+strconv.Itoa(i))
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0666))
+		files = append(files, file)
+	}
+	return files
+}
+
+func readOutputs(t *testing.T, dir string, nReduce int) []string {
+	var lines []string
+	for r := 0; r < nReduce; r++ {
+		data, err := os.ReadFile(OutputFile(dir, r))
+		assert.Nil(t, err)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestCoordinator(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	files := writeInputs(t, dir, "a b c", "b c", "c")
+	outDir := filepath.Join(dir, "out")
+	c, err := NewCoordinator(files, 2, WithOutDir(outDir), WithTaskTimeout(200*time.Millisecond))
+	assert.Nil(err)
+	assert.Nil(c.Serve("127.0.0.1:0"))
+	defer c.Close()
+
+	// 模拟一个拿到任务后崩溃的 worker
+	client, err := rpc.Dial("tcp", c.Addr())
+	assert.Nil(err)
+	var reply TaskReply
+	assert.Nil(client.Call(rpcName+".RequestTask", &TaskArgs{}, &reply))
+	assert.Equal(MapTask, reply.Type)
+	client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(Worker(c.Addr(), wordCountMap, wordCountReduce))
+		}()
+	}
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("job not finished")
+	}
+	wg.Wait()
+
+	assert.Equal([]string{"a 1", "b 2", "c 3"}, readOutputs(t, outDir, 2))
+	// 临时文件不能残留
+	matches, err := filepath.Glob(filepath.Join(outDir, "mr-tmp-*"))
+	assert.Nil(err)
+	assert.Empty(matches)
+}
+
+func TestStaleReport(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	files := writeInputs(t, dir, "a")
+	c, err := NewCoordinator(files, 1, WithOutDir(dir), WithTaskTimeout(20*time.Millisecond))
+	assert.Nil(err)
+	assert.Nil(c.Serve("127.0.0.1:0"))
+	defer c.Close()
+
+	client, err := rpc.Dial("tcp", c.Addr())
+	assert.Nil(err)
+	defer client.Close()
+
+	var first, second TaskReply
+	assert.Nil(client.Call(rpcName+".RequestTask", &TaskArgs{}, &first))
+	time.Sleep(30 * time.Millisecond)
+	// 第一次执行超时，任务被重新分配
+	assert.Nil(client.Call(rpcName+".RequestTask", &TaskArgs{}, &second))
+	assert.Equal(first.ID, second.ID)
+	assert.Equal(first.Attempt+1, second.Attempt)
+
+	report := func(reply *TaskReply) {
+		args := &ReportArgs{Type: reply.Type, ID: reply.ID, Attempt: reply.Attempt}
+		assert.Nil(client.Call(rpcName+".ReportTask", args, &ReportReply{}))
+	}
+	// 过期的上报被丢弃
+	report(&first)
+	var wait TaskReply
+	assert.Nil(client.Call(rpcName+".RequestTask", &TaskArgs{}, &wait))
+	assert.Equal(WaitTask, wait.Type)
+
+	report(&second)
+	var next TaskReply
+	assert.Nil(client.Call(rpcName+".RequestTask", &TaskArgs{}, &next))
+	assert.Equal(ReduceTask, next.Type)
+}
+
+func TestNewCoordinator(t *testing.T) {
+	_, err := NewCoordinator(nil, 1)
+	assert.NotNil(t, err)
+	_, err = NewCoordinator([]string{"a"}, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,69 @@
+package dist
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// TaskType is the kind of work handed out by the coordinator.
+type TaskType int
+
+const (
+	// MapTask asks the worker to map one input file.
+	MapTask TaskType = iota
+	// ReduceTask asks the worker to reduce one partition.
+	ReduceTask
+	// WaitTask asks the worker to retry later, all tasks of the current phase are running.
+	WaitTask
+	// ExitTask asks the worker to exit, the job is done.
+	ExitTask
+)
+
+type (
+	// KeyValue is emitted by MapFunc and consumed by ReduceFunc.
+	KeyValue struct {
+		Key   string
+		Value string
+	}
+
+	// TaskArgs is the argument of Coordinator.RequestTask.
+	TaskArgs struct {
+	}
+
+	// TaskReply describes the task assigned to a worker, Attempt increases
+	// every time the task is handed out again.
+	TaskReply struct {
+		Type    TaskType
+		ID      int
+		Attempt int
+		File    string
+		NMap    int
+		NReduce int
+		OutDir  string
+	}
+
+	// ReportArgs is the argument of Coordinator.ReportTask, a report whose
+	// Attempt is not the latest one of the task is dropped.
+	ReportArgs struct {
+		Type    TaskType
+		ID      int
+		Attempt int
+	}
+
+	// ReportReply is the reply of Coordinator.ReportTask.
+	ReportReply struct {
+	}
+)
+
+// rpcName is the name the coordinator is registered with
+const rpcName = "Coordinator"
+
+// intermediateFile 是 map 任务 m 输出给 reduce 任务 r 的文件
+func intermediateFile(dir string, m, r int) string {
+	return filepath.Join(dir, fmt.Sprintf("mr-%d-%d", m, r))
+}
+
+// OutputFile returns the output file of reduce task r.
+func OutputFile(dir string, r int) string {
+	return filepath.Join(dir, fmt.Sprintf("mr-out-%d", r))
+}
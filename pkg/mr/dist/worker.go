@@ -0,0 +1,161 @@
+package dist
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+const waitInterval = 100 * time.Millisecond
+
+type (
+	// MapFunc maps the contents of an input file to key/value pairs.
+	MapFunc func(filename string, contents string) []KeyValue
+	// ReduceFunc reduces all the values of a key.
+	ReduceFunc func(key string, values []string) string
+)
+
+// Worker keeps asking the coordinator at addr for tasks and runs them,
+// it returns nil once the coordinator reports that the job is done.
+func Worker(addr string, mapf MapFunc, reducef ReduceFunc) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial coordinator %s err: %s", addr, err)
+	}
+	defer client.Close()
+
+	for {
+		var reply TaskReply
+		err = client.Call(rpcName+".RequestTask", &TaskArgs{}, &reply)
+		if err != nil {
+			return fmt.Errorf("request task err: %s", err)
+		}
+
+		switch reply.Type {
+		case MapTask:
+			err = doMap(&reply, mapf)
+		case ReduceTask:
+			err = doReduce(&reply, reducef)
+		case WaitTask:
+			time.Sleep(waitInterval)
+			continue
+		case ExitTask:
+			return nil
+		}
+		if err != nil {
+			// 不上报，任务超时后由 coordinator 重新分配
+			return err
+		}
+
+		args := &ReportArgs{Type: reply.Type, ID: reply.ID, Attempt: reply.Attempt}
+		if err = client.Call(rpcName+".ReportTask", args, &ReportReply{}); err != nil {
+			return fmt.Errorf("report task err: %s", err)
+		}
+	}
+}
+
+func doMap(reply *TaskReply, mapf MapFunc) error {
+	contents, err := os.ReadFile(reply.File)
+	if err != nil {
+		return fmt.Errorf("read %s err: %s", reply.File, err)
+	}
+
+	partitions := make([][]KeyValue, reply.NReduce)
+	for _, kv := range mapf(reply.File, string(contents)) {
+		r := hash.Murmur332([]byte(kv.Key), hash.DefaultSeed) % uint32(reply.NReduce)
+		partitions[r] = append(partitions[r], kv)
+	}
+
+	for r, kvs := range partitions {
+		err = commitFile(intermediateFile(reply.OutDir, reply.ID, r), func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			for _, kv := range kvs {
+				if err := enc.Encode(&kv); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doReduce(reply *TaskReply, reducef ReduceFunc) error {
+	var kvs []KeyValue
+	for m := 0; m < reply.NMap; m++ {
+		path := intermediateFile(reply.OutDir, m, reply.ID)
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open %s err: %s", path, err)
+		}
+		dec := json.NewDecoder(file)
+		for {
+			var kv KeyValue
+			if err = dec.Decode(&kv); err == io.EOF {
+				break
+			} else if err != nil {
+				file.Close()
+				return fmt.Errorf("decode %s err: %s", path, err)
+			}
+			kvs = append(kvs, kv)
+		}
+		file.Close()
+	}
+
+	sort.SliceStable(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+
+	return commitFile(OutputFile(reply.OutDir, reply.ID), func(w io.Writer) error {
+		for i := 0; i < len(kvs); {
+			j := i
+			var values []string
+			for ; j < len(kvs) && kvs[j].Key == kvs[i].Key; j++ {
+				values = append(values, kvs[j].Value)
+			}
+			if _, err := fmt.Fprintf(w, "%v %v\n", kvs[i].Key, reducef(kvs[i].Key, values)); err != nil {
+				return err
+			}
+			i = j
+		}
+		return nil
+	})
+}
+
+// commitFile 先写临时文件，再原子 rename 到 path，
+// 避免崩溃的 worker 留下写了一半的文件
+func commitFile(path string, write func(w io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "mr-tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file err: %s", err)
+	}
+	defer os.Remove(temp.Name())
+
+	writer := bufio.NewWriter(temp)
+	if err = write(writer); err != nil {
+		temp.Close()
+		return fmt.Errorf("write %s err: %s", path, err)
+	}
+	if err = writer.Flush(); err != nil {
+		temp.Close()
+		return fmt.Errorf("flush %s err: %s", path, err)
+	}
+	if err = temp.Close(); err != nil {
+		return fmt.Errorf("close %s err: %s", path, err)
+	}
+	if err = os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("rename %s err: %s", path, err)
+	}
+	return nil
+}
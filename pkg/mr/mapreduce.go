@@ -3,15 +3,20 @@ package mr
 import (
 	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pedrogao/plib/pkg/common"
 )
 
 const (
-	defaultWorkers = 16
-	minWorkers     = 1
+	defaultWorkers     = 16
+	minWorkers         = 1
+	defaultPartitions  = 4
+	defaultMemoryLimit = 64 << 20
 )
 
 var (
@@ -19,95 +24,124 @@ var (
 	ErrCancelWithNil = errors.New("mapreduce cancelled with nil")
 	// ErrReduceNoOutput is an error that reduce did not output a value.
 	ErrReduceNoOutput = errors.New("reduce not writing value")
+	// ErrReduceMoreOutput is an error that reduce wrote more than one value.
+	ErrReduceMoreOutput = errors.New("more than one element written in reducer")
 )
 
 type (
 	// ForEachFunc is used to do element processing, but no output.
-	ForEachFunc func(item interface{})
+	// A returned error cancels the processing, unless retried or within the failure budget.
+	ForEachFunc[T any] func(ctx context.Context, item T) error
 	// GenerateFunc is used to let callers send elements into source.
-	GenerateFunc func(source chan<- interface{})
+	GenerateFunc[T any] func(source chan<- T)
 	// MapFunc is used to do element processing and write the output to writer.
-	MapFunc func(item interface{}, writer Writer)
+	MapFunc[T, U any] func(ctx context.Context, item T, writer Writer[U])
 	// MapperFunc is used to do element processing and write the output to writer,
 	// use cancel func to cancel the processing.
-	MapperFunc func(item interface{}, writer Writer, cancel func(error))
+	MapperFunc[T, U any] func(ctx context.Context, item T, writer Writer[U], cancel func(error))
 	// ReducerFunc is used to reduce all the mapping output and write to writer,
 	// use cancel func to cancel the processing.
-	ReducerFunc func(pipe <-chan interface{}, writer Writer, cancel func(error))
+	ReducerFunc[U, V any] func(pipe <-chan U, writer Writer[V], cancel func(error))
 	// VoidReducerFunc is used to reduce all the mapping output, but no output.
 	// Use cancel func to cancel the processing.
-	VoidReducerFunc func(pipe <-chan interface{}, cancel func(error))
+	VoidReducerFunc[U any] func(pipe <-chan U, cancel func(error))
 	// Option defines the method to customize the mapreduce.
 	Option func(opts *mapReduceOptions)
 
-	mapperContext struct {
+	mapperContext[T, U any] struct {
 		ctx       context.Context
-		mapper    MapFunc
-		source    <-chan interface{}
+		mapper    MapFunc[T, U]
+		source    <-chan T
 		panicChan *onceChan
-		collector chan<- interface{}
+		collector chan<- U
 		doneChan  <-chan common.PlaceholderType
 		workers   int
 	}
 
 	mapReduceOptions struct {
-		ctx     context.Context
-		workers int
+		ctx           context.Context
+		workers       int
+		partitions    int
+		memoryLimit   int
+		tempDir       string
+		retries       int
+		backoff       time.Duration
+		itemTimeout   time.Duration
+		failureBudget int
+		progress      ProgressFunc
 	}
 
 	// Writer interface wraps Write method.
-	Writer interface {
-		Write(v interface{})
+	Writer[T any] interface {
+		Write(v T)
+	}
+
+	// PanicError is returned when the generator, a mapper or the reducer panics.
+	PanicError struct {
+		Value any
+		Stack []byte
 	}
 )
 
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("mapreduce panic: %v\n%s", e.Value, e.Stack)
+}
+
 // Finish runs fns parallel, cancelled on any error.
 func Finish(fns ...func() error) error {
 	if len(fns) == 0 {
 		return nil
 	}
 
-	return MapReduceVoid(func(source chan<- interface{}) {
+	return MapReduceVoid(func(source chan<- func() error) {
 		for _, fn := range fns {
 			source <- fn
 		}
-	}, func(item interface{}, writer Writer, cancel func(error)) {
-		fn := item.(func() error)
+	}, func(ctx context.Context, fn func() error, writer Writer[any], cancel func(error)) {
 		if err := fn(); err != nil {
 			cancel(err)
 		}
-	}, func(pipe <-chan interface{}, cancel func(error)) {
+	}, func(pipe <-chan any, cancel func(error)) {
 	}, WithWorkers(len(fns)))
 }
 
-// FinishVoid runs fns parallel.
-func FinishVoid(fns ...func()) {
+// FinishVoid runs fns parallel, returns an error only if any of fns panics.
+func FinishVoid(fns ...func()) error {
 	if len(fns) == 0 {
-		return
+		return nil
 	}
 
-	ForEach(func(source chan<- interface{}) {
+	return ForEach(func(source chan<- func()) {
 		for _, fn := range fns {
 			source <- fn
 		}
-	}, func(item interface{}) {
-		fn := item.(func())
+	}, func(ctx context.Context, fn func()) error {
 		fn()
+		return nil
 	}, WithWorkers(len(fns)))
 }
 
 // ForEach maps all elements from given generate but no output.
-func ForEach(generate GenerateFunc, mapper ForEachFunc, opts ...Option) {
+func ForEach[T any](generate GenerateFunc[T], mapper ForEachFunc[T], opts ...Option) error {
 	options := buildOptions(opts...)
-	panicChan := &onceChan{channel: make(chan interface{})}
+	panicChan := newOnceChan()
 	source := buildSource(generate, panicChan)
-	collector := make(chan interface{})
+	collector := make(chan any)
 	done := make(chan common.PlaceholderType)
-
-	go executeMappers(mapperContext{
-		ctx: options.ctx,
-		mapper: func(item interface{}, _ Writer) {
-			mapper(item)
+	ctx, cancelCtx := context.WithCancel(options.ctx)
+	defer cancelCtx()
+	policy := newItemPolicy(options)
+
+	go executeMappers(mapperContext[T, any]{
+		ctx: ctx,
+		mapper: func(ctx context.Context, item T, w Writer[any]) {
+			err := runItem(ctx, policy, w, func(ctx context.Context, _ Writer[any]) error {
+				return mapper(ctx, item)
+			})
+			if err != nil {
+				// 和 panic 一样，第一个错误会结束整个流程
+				panicChan.write(err)
+			}
 		},
 		source:    source,
 		panicChan: panicChan,
@@ -118,11 +152,17 @@ func ForEach(generate GenerateFunc, mapper ForEachFunc, opts ...Option) {
 
 	for {
 		select {
-		case v := <-panicChan.channel:
-			panic(v)
+		case err := <-panicChan.channel:
+			cancelCtx()
+			close(done)
+			drain(collector)
+			return err
 		case _, ok := <-collector:
 			if !ok {
-				return
+				if err := panicChan.load(); err != nil {
+					return err
+				}
+				return options.ctx.Err()
 			}
 		}
 	}
@@ -130,37 +170,41 @@ func ForEach(generate GenerateFunc, mapper ForEachFunc, opts ...Option) {
 
 // MapReduce maps all elements generated from given generate func,
 // and reduces the output elements with given reducer.
-func MapReduce(generate GenerateFunc, mapper MapperFunc, reducer ReducerFunc,
-	opts ...Option) (interface{}, error) {
-	panicChan := &onceChan{channel: make(chan interface{})}
+func MapReduce[T, U, V any](generate GenerateFunc[T], mapper MapperFunc[T, U], reducer ReducerFunc[U, V],
+	opts ...Option) (V, error) {
+	panicChan := newOnceChan()
 	source := buildSource(generate, panicChan)
 	return mapReduceWithPanicChan(source, panicChan, mapper, reducer, opts...)
 }
 
 // MapReduceChan maps all elements from source, and reduce the output elements with given reducer.
-func MapReduceChan(source <-chan interface{}, mapper MapperFunc, reducer ReducerFunc,
-	opts ...Option) (interface{}, error) {
-	panicChan := &onceChan{channel: make(chan interface{})}
+func MapReduceChan[T, U, V any](source <-chan T, mapper MapperFunc[T, U], reducer ReducerFunc[U, V],
+	opts ...Option) (V, error) {
+	panicChan := newOnceChan()
 	return mapReduceWithPanicChan(source, panicChan, mapper, reducer, opts...)
 }
 
-// MapReduceChan maps all elements from source, and reduce the output elements with given reducer.
-func mapReduceWithPanicChan(source <-chan interface{}, panicChan *onceChan, mapper MapperFunc,
-	reducer ReducerFunc, opts ...Option) (interface{}, error) {
+// mapReduceWithPanicChan maps all elements from source, and reduce the output elements with given reducer.
+func mapReduceWithPanicChan[T, U, V any](source <-chan T, panicChan *onceChan, mapper MapperFunc[T, U],
+	reducer ReducerFunc[U, V], opts ...Option) (val V, err error) {
 	options := buildOptions(opts...)
 	// output is used to write the final result
-	output := make(chan interface{})
+	output := make(chan V)
 	defer func() {
-		// reducer can only write once, if more, panic
+		// reducer can only write once, if more, return error
 		for range output {
-			panic("more than one element written in reducer")
+			var zero V
+			val, err = zero, ErrReduceMoreOutput
 		}
 	}()
 
 	// collector is used to collect data from mapper, and consume in reducer
-	collector := make(chan interface{}, options.workers)
+	collector := make(chan U, options.workers)
 	// if done is closed, all mappers and reducer should stop processing
 	done := make(chan common.PlaceholderType)
+	// ctx is passed into every mapper, and cancelled once the processing stops
+	ctx, cancelCtx := context.WithCancel(options.ctx)
+	defer cancelCtx()
 	writer := newGuardedWriter(options.ctx, output, done)
 	var closeOnce sync.Once
 	// use atomic.Value to avoid data race
@@ -178,6 +222,7 @@ func mapReduceWithPanicChan(source <-chan interface{}, panicChan *onceChan, mapp
 			retErr.Set(ErrCancelWithNil)
 		}
 
+		cancelCtx()
 		drain(source)
 		finish()
 	})
@@ -186,7 +231,7 @@ func mapReduceWithPanicChan(source <-chan interface{}, panicChan *onceChan, mapp
 		defer func() {
 			drain(collector)
 			if r := recover(); r != nil {
-				panicChan.write(r)
+				panicChan.write(newPanicError(r))
 			}
 			finish()
 		}()
@@ -194,10 +239,29 @@ func mapReduceWithPanicChan(source <-chan interface{}, panicChan *onceChan, mapp
 		reducer(collector, writer, cancel)
 	}()
 
-	go executeMappers(mapperContext{
-		ctx: options.ctx,
-		mapper: func(item interface{}, w Writer) {
-			mapper(item, w, cancel)
+	policy := newItemPolicy(options)
+	go executeMappers(mapperContext[T, U]{
+		ctx: ctx,
+		mapper: func(ctx context.Context, item T, w Writer[U]) {
+			if policy == nil {
+				mapper(ctx, item, w, cancel)
+				return
+			}
+
+			// mapper 中的 cancel 只让当前 item 失败，由 policy 决定是否重试或取消整个流程
+			err := runItem(ctx, policy, w, func(ctx context.Context, w Writer[U]) error {
+				var itemErr error
+				mapper(ctx, item, w, once(func(err error) {
+					if err == nil {
+						err = ErrCancelWithNil
+					}
+					itemErr = err
+				}))
+				return itemErr
+			})
+			if err != nil {
+				cancel(err)
+			}
 		},
 		source:    source,
 		panicChan: panicChan,
@@ -208,25 +272,31 @@ func mapReduceWithPanicChan(source <-chan interface{}, panicChan *onceChan, mapp
 
 	select {
 	case <-options.ctx.Done():
-		cancel(context.DeadlineExceeded)
-		return nil, context.DeadlineExceeded
-	case v := <-panicChan.channel:
-		panic(v)
+		err := options.ctx.Err()
+		cancel(err)
+		return val, err
+	case err := <-panicChan.channel:
+		cancel(err)
+		return val, err
 	case v, ok := <-output:
-		if err := retErr.Load(); err != nil {
-			return nil, err
+		// panics are always reported before output is written or closed
+		if err := panicChan.load(); err != nil {
+			return val, err
+		} else if err := retErr.Load(); err != nil {
+			return val, err
 		} else if ok {
 			return v, nil
 		} else {
-			return nil, ErrReduceNoOutput
+			return val, ErrReduceNoOutput
 		}
 	}
 }
 
 // MapReduceVoid maps all elements generated from given generate,
 // and reduce the output elements with given reducer.
-func MapReduceVoid(generate GenerateFunc, mapper MapperFunc, reducer VoidReducerFunc, opts ...Option) error {
-	_, err := MapReduce(generate, mapper, func(input <-chan interface{}, writer Writer, cancel func(error)) {
+func MapReduceVoid[T, U any](generate GenerateFunc[T], mapper MapperFunc[T, U],
+	reducer VoidReducerFunc[U], opts ...Option) error {
+	_, err := MapReduce(generate, mapper, func(input <-chan U, writer Writer[any], cancel func(error)) {
 		reducer(input, cancel)
 	}, opts...)
 	if errors.Is(err, ErrReduceNoOutput) {
@@ -263,12 +333,12 @@ func buildOptions(opts ...Option) *mapReduceOptions {
 	return options
 }
 
-func buildSource(generate GenerateFunc, panicChan *onceChan) chan interface{} {
-	source := make(chan interface{})
+func buildSource[T any](generate GenerateFunc[T], panicChan *onceChan) chan T {
+	source := make(chan T)
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				panicChan.write(r) // 写入panic信息
+				panicChan.write(newPanicError(r)) // 写入panic信息
 			}
 			close(source) //关闭source
 		}()
@@ -280,13 +350,13 @@ func buildSource(generate GenerateFunc, panicChan *onceChan) chan interface{} {
 }
 
 // drain drains the channel.
-func drain(channel <-chan interface{}) {
+func drain[T any](channel <-chan T) {
 	// drain the channel
 	for range channel {
 	}
 }
 
-func executeMappers(mCtx mapperContext) {
+func executeMappers[T, U any](mCtx mapperContext[T, U]) {
 	var wg sync.WaitGroup
 	defer func() {
 		wg.Wait()
@@ -315,13 +385,13 @@ func executeMappers(mCtx mapperContext) {
 				defer func() {
 					if r := recover(); r != nil {
 						atomic.AddInt32(&failed, 1)
-						mCtx.panicChan.write(r)
+						mCtx.panicChan.write(newPanicError(r))
 					}
 					wg.Done()
 					<-pool
 				}()
 
-				mCtx.mapper(item, writer)
+				mCtx.mapper(mCtx.ctx, item, writer)
 			}()
 		}
 	}
@@ -329,8 +399,17 @@ func executeMappers(mCtx mapperContext) {
 
 func newOptions() *mapReduceOptions {
 	return &mapReduceOptions{
-		ctx:     context.Background(),
-		workers: defaultWorkers,
+		ctx:         context.Background(),
+		workers:     defaultWorkers,
+		partitions:  defaultPartitions,
+		memoryLimit: defaultMemoryLimit,
+	}
+}
+
+func newPanicError(r any) error {
+	return &PanicError{
+		Value: r,
+		Stack: debug.Stack(),
 	}
 }
 
@@ -343,22 +422,22 @@ func once(fn func(error)) func(error) {
 	}
 }
 
-type guardedWriter struct {
+type guardedWriter[T any] struct {
 	ctx     context.Context
-	channel chan<- interface{}
+	channel chan<- T
 	done    <-chan common.PlaceholderType
 }
 
-func newGuardedWriter(ctx context.Context, channel chan<- interface{},
-	done <-chan common.PlaceholderType) guardedWriter {
-	return guardedWriter{
+func newGuardedWriter[T any](ctx context.Context, channel chan<- T,
+	done <-chan common.PlaceholderType) guardedWriter[T] {
+	return guardedWriter[T]{
 		ctx:     ctx,
 		channel: channel,
 		done:    done,
 	}
 }
 
-func (gw guardedWriter) Write(v interface{}) {
+func (gw guardedWriter[T]) Write(v T) {
 	select {
 	case <-gw.ctx.Done():
 		return
@@ -369,13 +448,26 @@ func (gw guardedWriter) Write(v interface{}) {
 	}
 }
 
+// onceChan keeps the first panic, the channel is buffered so that
+// a late panic never blocks after the caller has returned.
 type onceChan struct {
-	channel chan interface{}
+	channel chan error
+	err     common.AtomicError
 	wrote   int32
 }
 
-func (oc *onceChan) write(val interface{}) {
+func newOnceChan() *onceChan {
+	return &onceChan{channel: make(chan error, 1)}
+}
+
+func (oc *onceChan) write(err error) {
 	if atomic.CompareAndSwapInt32(&oc.wrote, 0, 1) {
-		oc.channel <- val
+		oc.err.Set(err)
+		oc.channel <- err
 	}
 }
+
+// load returns the written error, even if it has been received from channel.
+func (oc *onceChan) load() error {
+	return oc.err.Load()
+}
@@ -4,6 +4,7 @@
 package mr
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"runtime"
@@ -54,28 +55,27 @@ func TestMapReduceRandom(t *testing.T) {
 				reducerIdx := rand.Int63n(n)
 				squareSum := (n - 1) * n * (2*n - 1) / 6
 
-				fn := func() (interface{}, error) {
-					return MapReduce(func(source chan<- interface{}) {
+				fn := func() (int64, error) {
+					return MapReduce(func(source chan<- int64) {
 						for i := int64(0); i < n; i++ {
 							source <- i
 							if genPanic && i == genIdx {
 								panic("foo")
 							}
 						}
-					}, func(item interface{}, writer Writer, cancel func(error)) {
-						v := item.(int64)
+					}, func(ctx context.Context, v int64, writer Writer[int64], cancel func(error)) {
 						if mapperPanic && v == mapperIdx {
 							panic("bar")
 						}
 						writer.Write(v * v)
-					}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
+					}, func(pipe <-chan int64, writer Writer[int64], cancel func(error)) {
 						var idx int64
 						var total int64
 						for v := range pipe {
 							if reducerPanic && idx == reducerIdx {
 								panic("baz")
 							}
-							total += v.(int64)
+							total += v
 							idx++
 						}
 						writer.Write(total)
@@ -91,11 +91,13 @@ func TestMapReduceRandom(t *testing.T) {
 					buf.WriteString(fmt.Sprintf(", genIdx: %d", genIdx))
 					buf.WriteString(fmt.Sprintf(", mapperIdx: %d", mapperIdx))
 					buf.WriteString(fmt.Sprintf(", reducerIdx: %d", reducerIdx))
-					assert.Panicsf(t, func() { fn() }, buf.String())
+					_, err := fn()
+					var pe *PanicError
+					assert.ErrorAsf(t, err, &pe, buf.String())
 				} else {
 					val, err := fn()
 					assert.Nil(t, err)
-					assert.Equal(t, squareSum, val.(int64))
+					assert.Equal(t, squareSum, val)
 				}
 				bar.Increment()
 			})
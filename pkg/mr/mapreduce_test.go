@@ -91,12 +91,13 @@ func TestForEach(t *testing.T) {
 		defer goleak.VerifyNone(t)
 
 		var count uint32
-		ForEach(func(source chan<- interface{}) {
+		ForEach(func(source chan<- int) {
 			for i := 0; i < tasks; i++ {
 				source <- i
 			}
-		}, func(item interface{}) {
+		}, func(ctx context.Context, item int) error {
 			atomic.AddUint32(&count, 1)
+			return nil
 		}, WithWorkers(-1))
 
 		assert.Equal(t, tasks, int(count))
@@ -106,14 +107,15 @@ func TestForEach(t *testing.T) {
 		defer goleak.VerifyNone(t)
 
 		var count uint32
-		ForEach(func(source chan<- interface{}) {
+		ForEach(func(source chan<- int) {
 			for i := 0; i < tasks; i++ {
 				source <- i
 			}
-		}, func(item interface{}) {
-			if item.(int)%2 == 0 {
+		}, func(ctx context.Context, item int) error {
+			if item%2 == 0 {
 				atomic.AddUint32(&count, 1)
 			}
+			return nil
 		})
 
 		assert.Equal(t, tasks/2, int(count))
@@ -122,15 +124,14 @@ func TestForEach(t *testing.T) {
 	t.Run("all", func(t *testing.T) {
 		defer goleak.VerifyNone(t)
 
-		assert.PanicsWithValue(t, "foo", func() {
-			ForEach(func(source chan<- interface{}) {
-				for i := 0; i < tasks; i++ {
-					source <- i
-				}
-			}, func(item interface{}) {
-				panic("foo")
-			})
+		err := ForEach(func(source chan<- int) {
+			for i := 0; i < tasks; i++ {
+				source <- i
+			}
+		}, func(ctx context.Context, item int) error {
+			panic("foo")
 		})
+		assertPanicError(t, "foo", err)
 	})
 }
 
@@ -138,12 +139,12 @@ func TestGeneratePanic(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
 	t.Run("all", func(t *testing.T) {
-		assert.PanicsWithValue(t, "foo", func() {
-			ForEach(func(source chan<- interface{}) {
-				panic("foo")
-			}, func(item interface{}) {
-			})
+		err := ForEach(func(source chan<- int) {
+			panic("foo")
+		}, func(ctx context.Context, item int) error {
+			return nil
 		})
+		assertPanicError(t, "foo", err)
 	})
 }
 
@@ -153,17 +154,16 @@ func TestMapperPanic(t *testing.T) {
 	const tasks = 1000
 	var run int32
 	t.Run("all", func(t *testing.T) {
-		assert.PanicsWithValue(t, "foo", func() {
-			_, _ = MapReduce(func(source chan<- interface{}) {
-				for i := 0; i < tasks; i++ {
-					source <- i
-				}
-			}, func(item interface{}, writer Writer, cancel func(error)) {
-				atomic.AddInt32(&run, 1)
-				panic("foo")
-			}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
-			})
+		_, err := MapReduce(func(source chan<- int) {
+			for i := 0; i < tasks; i++ {
+				source <- i
+			}
+		}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+			atomic.AddInt32(&run, 1)
+			panic("foo")
+		}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
 		})
+		assertPanicError(t, "foo", err)
 		assert.True(t, atomic.LoadInt32(&run) < tasks/2)
 	})
 }
@@ -173,10 +173,10 @@ func TestMapReduce(t *testing.T) {
 
 	tests := []struct {
 		name        string
-		mapper      MapperFunc
-		reducer     ReducerFunc
+		mapper      MapperFunc[int, int]
+		reducer     ReducerFunc[int, int]
 		expectErr   error
-		expectValue interface{}
+		expectValue int
 	}{
 		{
 			name:        "simple",
@@ -185,8 +185,8 @@ func TestMapReduce(t *testing.T) {
 		},
 		{
 			name: "cancel with error",
-			mapper: func(item interface{}, writer Writer, cancel func(error)) {
-				v := item.(int)
+			mapper: func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+				v := item
 				if v%3 == 0 {
 					cancel(errDummy)
 				}
@@ -196,22 +196,22 @@ func TestMapReduce(t *testing.T) {
 		},
 		{
 			name: "cancel with nil",
-			mapper: func(item interface{}, writer Writer, cancel func(error)) {
-				v := item.(int)
+			mapper: func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+				v := item
 				if v%3 == 0 {
 					cancel(nil)
 				}
 				writer.Write(v * v)
 			},
 			expectErr:   ErrCancelWithNil,
-			expectValue: nil,
+			expectValue: 0,
 		},
 		{
 			name: "cancel with more",
-			reducer: func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
+			reducer: func(pipe <-chan int, writer Writer[int], cancel func(error)) {
 				var result int
 				for item := range pipe {
-					result += item.(int)
+					result += item
 					if result > 10 {
 						cancel(errDummy)
 					}
@@ -226,21 +226,21 @@ func TestMapReduce(t *testing.T) {
 		for _, test := range tests {
 			t.Run(test.name, func(t *testing.T) {
 				if test.mapper == nil {
-					test.mapper = func(item interface{}, writer Writer, cancel func(error)) {
-						v := item.(int)
+					test.mapper = func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+						v := item
 						writer.Write(v * v)
 					}
 				}
 				if test.reducer == nil {
-					test.reducer = func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
+					test.reducer = func(pipe <-chan int, writer Writer[int], cancel func(error)) {
 						var result int
 						for item := range pipe {
-							result += item.(int)
+							result += item
 						}
 						writer.Write(result)
 					}
 				}
-				value, err := MapReduce(func(source chan<- interface{}) {
+				value, err := MapReduce(func(source chan<- int) {
 					for i := 1; i < 5; i++ {
 						source <- i
 					}
@@ -256,22 +256,22 @@ func TestMapReduce(t *testing.T) {
 		for _, test := range tests {
 			t.Run(test.name, func(t *testing.T) {
 				if test.mapper == nil {
-					test.mapper = func(item interface{}, writer Writer, cancel func(error)) {
-						v := item.(int)
+					test.mapper = func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+						v := item
 						writer.Write(v * v)
 					}
 				}
 				if test.reducer == nil {
-					test.reducer = func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
+					test.reducer = func(pipe <-chan int, writer Writer[int], cancel func(error)) {
 						var result int
 						for item := range pipe {
-							result += item.(int)
+							result += item
 						}
 						writer.Write(result)
 					}
 				}
 
-				source := make(chan interface{})
+				source := make(chan int)
 				go func() {
 					for i := 1; i < 5; i++ {
 						source <- i
@@ -290,19 +290,18 @@ func TestMapReduce(t *testing.T) {
 func TestMapReduceWithReduerWriteMoreThanOnce(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
-	assert.Panics(t, func() {
-		MapReduce(func(source chan<- interface{}) {
-			for i := 0; i < 10; i++ {
-				source <- i
-			}
-		}, func(item interface{}, writer Writer, cancel func(error)) {
-			writer.Write(item)
-		}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
-			drain(pipe)
-			writer.Write("one")
-			writer.Write("two")
-		})
+	_, err := MapReduce(func(source chan<- int) {
+		for i := 0; i < 10; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		writer.Write(item)
+	}, func(pipe <-chan int, writer Writer[string], cancel func(error)) {
+		drain(pipe)
+		writer.Write("one")
+		writer.Write("two")
 	})
+	assert.Equal(t, ErrReduceMoreOutput, err)
 }
 
 func TestMapReduceVoid(t *testing.T) {
@@ -311,8 +310,8 @@ func TestMapReduceVoid(t *testing.T) {
 	var value uint32
 	tests := []struct {
 		name        string
-		mapper      MapperFunc
-		reducer     VoidReducerFunc
+		mapper      MapperFunc[int, int]
+		reducer     VoidReducerFunc[int]
 		expectValue uint32
 		expectErr   error
 	}{
@@ -323,8 +322,8 @@ func TestMapReduceVoid(t *testing.T) {
 		},
 		{
 			name: "cancel with error",
-			mapper: func(item interface{}, writer Writer, cancel func(error)) {
-				v := item.(int)
+			mapper: func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+				v := item
 				if v%3 == 0 {
 					cancel(errDummy)
 				}
@@ -334,8 +333,8 @@ func TestMapReduceVoid(t *testing.T) {
 		},
 		{
 			name: "cancel with nil",
-			mapper: func(item interface{}, writer Writer, cancel func(error)) {
-				v := item.(int)
+			mapper: func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+				v := item
 				if v%3 == 0 {
 					cancel(nil)
 				}
@@ -345,9 +344,9 @@ func TestMapReduceVoid(t *testing.T) {
 		},
 		{
 			name: "cancel with more",
-			reducer: func(pipe <-chan interface{}, cancel func(error)) {
+			reducer: func(pipe <-chan int, cancel func(error)) {
 				for item := range pipe {
-					result := atomic.AddUint32(&value, uint32(item.(int)))
+					result := atomic.AddUint32(&value, uint32(item))
 					if result > 10 {
 						cancel(errDummy)
 					}
@@ -362,19 +361,19 @@ func TestMapReduceVoid(t *testing.T) {
 			atomic.StoreUint32(&value, 0)
 
 			if test.mapper == nil {
-				test.mapper = func(item interface{}, writer Writer, cancel func(error)) {
-					v := item.(int)
+				test.mapper = func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+					v := item
 					writer.Write(v * v)
 				}
 			}
 			if test.reducer == nil {
-				test.reducer = func(pipe <-chan interface{}, cancel func(error)) {
+				test.reducer = func(pipe <-chan int, cancel func(error)) {
 					for item := range pipe {
-						atomic.AddUint32(&value, uint32(item.(int)))
+						atomic.AddUint32(&value, uint32(item))
 					}
 				}
 			}
-			err := MapReduceVoid(func(source chan<- interface{}) {
+			err := MapReduceVoid(func(source chan<- int) {
 				for i := 1; i < 5; i++ {
 					source <- i
 				}
@@ -392,18 +391,18 @@ func TestMapReduceVoidWithDelay(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
 	var result []int
-	err := MapReduceVoid(func(source chan<- interface{}) {
+	err := MapReduceVoid(func(source chan<- int) {
 		source <- 0
 		source <- 1
-	}, func(item interface{}, writer Writer, cancel func(error)) {
-		i := item.(int)
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		i := item
 		if i == 0 {
 			time.Sleep(time.Millisecond * 50)
 		}
 		writer.Write(i)
-	}, func(pipe <-chan interface{}, cancel func(error)) {
+	}, func(pipe <-chan int, cancel func(error)) {
 		for item := range pipe {
-			i := item.(int)
+			i := item
 			result = append(result, i)
 		}
 	})
@@ -416,74 +415,71 @@ func TestMapReduceVoidWithDelay(t *testing.T) {
 func TestMapReducePanic(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
-	assert.Panics(t, func() {
-		_, _ = MapReduce(func(source chan<- interface{}) {
-			source <- 0
-			source <- 1
-		}, func(item interface{}, writer Writer, cancel func(error)) {
-			i := item.(int)
-			writer.Write(i)
-		}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
-			for range pipe {
-				panic("panic")
-			}
-		})
+	_, err := MapReduce(func(source chan<- int) {
+		source <- 0
+		source <- 1
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		writer.Write(item)
+	}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
+		for range pipe {
+			panic("panic")
+		}
 	})
+	assertPanicError(t, "panic", err)
 }
 
 func TestMapReducePanicOnce(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
-	assert.Panics(t, func() {
-		_, _ = MapReduce(func(source chan<- interface{}) {
-			for i := 0; i < 100; i++ {
-				source <- i
-			}
-		}, func(item interface{}, writer Writer, cancel func(error)) {
-			i := item.(int)
-			if i == 0 {
-				panic("foo")
-			}
-			writer.Write(i)
-		}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
-			for range pipe {
-				panic("bar")
-			}
-		})
+	_, err := MapReduce(func(source chan<- int) {
+		for i := 0; i < 100; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		if item == 0 {
+			panic("foo")
+		}
+		writer.Write(item)
+	}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
+		for range pipe {
+			panic("bar")
+		}
 	})
+	var pe *PanicError
+	assert.ErrorAs(t, err, &pe)
 }
 
 func TestMapReducePanicBothMapperAndReducer(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
-	assert.Panics(t, func() {
-		_, _ = MapReduce(func(source chan<- interface{}) {
-			source <- 0
-			source <- 1
-		}, func(item interface{}, writer Writer, cancel func(error)) {
-			panic("foo")
-		}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
-			panic("bar")
-		})
+	_, err := MapReduce(func(source chan<- int) {
+		source <- 0
+		source <- 1
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		panic("foo")
+	}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
+		panic("bar")
 	})
+	var pe *PanicError
+	assert.ErrorAs(t, err, &pe)
 }
 
 func TestMapReduceVoidCancel(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
 	var result []int
-	err := MapReduceVoid(func(source chan<- interface{}) {
+	err := MapReduceVoid(func(source chan<- int) {
 		source <- 0
 		source <- 1
-	}, func(item interface{}, writer Writer, cancel func(error)) {
-		i := item.(int)
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		i := item
 		if i == 1 {
 			cancel(errors.New("anything"))
 		}
 		writer.Write(i)
-	}, func(pipe <-chan interface{}, cancel func(error)) {
+	}, func(pipe <-chan int, cancel func(error)) {
 		for item := range pipe {
-			i := item.(int)
+			i := item
 			result = append(result, i)
 		}
 	})
@@ -496,20 +492,20 @@ func TestMapReduceVoidCancelWithRemains(t *testing.T) {
 
 	var done int32
 	var result []int
-	err := MapReduceVoid(func(source chan<- interface{}) {
+	err := MapReduceVoid(func(source chan<- int) {
 		for i := 0; i < defaultWorkers*2; i++ {
 			source <- i
 		}
 		atomic.AddInt32(&done, 1)
-	}, func(item interface{}, writer Writer, cancel func(error)) {
-		i := item.(int)
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		i := item
 		if i == defaultWorkers/2 {
 			cancel(errors.New("anything"))
 		}
 		writer.Write(i)
-	}, func(pipe <-chan interface{}, cancel func(error)) {
+	}, func(pipe <-chan int, cancel func(error)) {
 		for item := range pipe {
-			i := item.(int)
+			i := item
 			result = append(result, i)
 		}
 	})
@@ -522,38 +518,36 @@ func TestMapReduceWithoutReducerWrite(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
 	uids := []int{1, 2, 3}
-	res, err := MapReduce(func(source chan<- interface{}) {
+	res, err := MapReduce(func(source chan<- int) {
 		for _, uid := range uids {
 			source <- uid
 		}
-	}, func(item interface{}, writer Writer, cancel func(error)) {
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
 		writer.Write(item)
-	}, func(pipe <-chan interface{}, writer Writer, cancel func(error)) {
+	}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
 		drain(pipe)
 		// not calling writer.Write(...), should not panic
 	})
 	assert.Equal(t, ErrReduceNoOutput, err)
-	assert.Nil(t, res)
+	assert.Zero(t, res)
 }
 
 func TestMapReduceVoidPanicInReducer(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
 	const message = "foo"
-	assert.Panics(t, func() {
-		var done int32
-		_ = MapReduceVoid(func(source chan<- interface{}) {
-			for i := 0; i < defaultWorkers*2; i++ {
-				source <- i
-			}
-			atomic.AddInt32(&done, 1)
-		}, func(item interface{}, writer Writer, cancel func(error)) {
-			i := item.(int)
-			writer.Write(i)
-		}, func(pipe <-chan interface{}, cancel func(error)) {
-			panic(message)
-		}, WithWorkers(1))
-	})
+	var done int32
+	err := MapReduceVoid(func(source chan<- int) {
+		for i := 0; i < defaultWorkers*2; i++ {
+			source <- i
+		}
+		atomic.AddInt32(&done, 1)
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		writer.Write(item)
+	}, func(pipe <-chan int, cancel func(error)) {
+		panic(message)
+	}, WithWorkers(1))
+	assertPanicError(t, message, err)
 }
 
 func TestForEachWithContext(t *testing.T) {
@@ -561,16 +555,17 @@ func TestForEachWithContext(t *testing.T) {
 
 	var done int32
 	ctx, cancel := context.WithCancel(context.Background())
-	ForEach(func(source chan<- interface{}) {
+	ForEach(func(source chan<- int) {
 		for i := 0; i < defaultWorkers*2; i++ {
 			source <- i
 		}
 		atomic.AddInt32(&done, 1)
-	}, func(item interface{}) {
-		i := item.(int)
+	}, func(ctx context.Context, item int) error {
+		i := item
 		if i == defaultWorkers/2 {
 			cancel()
 		}
+		return nil
 	}, WithContext(ctx))
 }
 
@@ -580,43 +575,106 @@ func TestMapReduceWithContext(t *testing.T) {
 	var done int32
 	var result []int
 	ctx, cancel := context.WithCancel(context.Background())
-	err := MapReduceVoid(func(source chan<- interface{}) {
+	err := MapReduceVoid(func(source chan<- int) {
 		for i := 0; i < defaultWorkers*2; i++ {
 			source <- i
 		}
 		atomic.AddInt32(&done, 1)
-	}, func(item interface{}, writer Writer, c func(error)) {
-		i := item.(int)
+	}, func(ctx context.Context, item int, writer Writer[int], c func(error)) {
+		i := item
 		if i == defaultWorkers/2 {
 			cancel()
 		}
 		writer.Write(i)
-	}, func(pipe <-chan interface{}, cancel func(error)) {
+	}, func(pipe <-chan int, cancel func(error)) {
 		for item := range pipe {
-			i := item.(int)
+			i := item
 			result = append(result, i)
 		}
 	}, WithContext(ctx))
 	assert.NotNil(t, err)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMapReduceWithContextTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := MapReduceVoid(func(source chan<- int) {
+		source <- 1
+	}, func(ctx context.Context, item int, writer Writer[int], c func(error)) {
+		<-ctx.Done()
+	}, func(pipe <-chan int, cancel func(error)) {
+		for range pipe {
+		}
+	}, WithContext(ctx))
 	assert.Equal(t, context.DeadlineExceeded, err)
 }
 
+func TestMapReduceMapperContext(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var cancelled int32
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	err := MapReduceVoid(func(source chan<- int) {
+		source <- 0
+		source <- 1
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		if item == 0 {
+			<-started
+			cancel(errDummy)
+			return
+		}
+		defer close(stopped)
+		close(started)
+		select {
+		case <-ctx.Done():
+			atomic.AddInt32(&cancelled, 1)
+		case <-time.After(time.Second):
+		}
+	}, func(pipe <-chan int, cancel func(error)) {
+		drain(pipe)
+	}, WithWorkers(2))
+	assert.Equal(t, errDummy, err)
+	<-stopped
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancelled))
+}
+
+func TestFinishVoidPanic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	err := FinishVoid(func() {}, func() {
+		panic("foo")
+	})
+	assertPanicError(t, "foo", err)
+}
+
+func assertPanicError(t *testing.T, expected any, err error) {
+	var pe *PanicError
+	if assert.ErrorAs(t, err, &pe) {
+		assert.Equal(t, expected, pe.Value)
+		assert.NotEmpty(t, pe.Stack)
+	}
+}
+
 func BenchmarkMapReduce(b *testing.B) {
 	b.ReportAllocs()
 
-	mapper := func(v interface{}, writer Writer, cancel func(error)) {
-		writer.Write(v.(int64) * v.(int64))
+	mapper := func(ctx context.Context, v int64, writer Writer[int64], cancel func(error)) {
+		writer.Write(v * v)
 	}
-	reducer := func(input <-chan interface{}, writer Writer, cancel func(error)) {
+	reducer := func(input <-chan int64, writer Writer[int64], cancel func(error)) {
 		var result int64
 		for v := range input {
-			result += v.(int64)
+			result += v
 		}
 		writer.Write(result)
 	}
 
 	for i := 0; i < b.N; i++ {
-		MapReduce(func(input chan<- interface{}) {
+		MapReduce(func(input chan<- int64) {
 			for j := 0; j < 2; j++ {
 				input <- int64(j)
 			}
@@ -0,0 +1,154 @@
+package mr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type (
+	// Progress reports how many items have been processed.
+	Progress struct {
+		// Processed is the number of items that succeeded.
+		Processed int
+		// Failed is the number of items that failed after all retries.
+		Failed int
+	}
+
+	// ProgressFunc is called after each item is done, calls are serialized.
+	ProgressFunc func(p Progress)
+
+	// itemPolicy 对每个 item 的重试、超时、失败预算与进度
+	itemPolicy struct {
+		retries  int
+		backoff  time.Duration
+		timeout  time.Duration
+		budget   int
+		progress ProgressFunc
+		lock     sync.Mutex
+		stat     Progress
+	}
+)
+
+// WithRetry customizes how many times a failed item is retried,
+// waiting backoff, 2*backoff, 4*backoff... between attempts.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(opts *mapReduceOptions) {
+		opts.retries = retries
+		opts.backoff = backoff
+	}
+}
+
+// WithItemTimeout customizes the timeout of each attempt of an item,
+// an attempt that exceeds it fails with context.DeadlineExceeded.
+func WithItemTimeout(timeout time.Duration) Option {
+	return func(opts *mapReduceOptions) {
+		opts.itemTimeout = timeout
+	}
+}
+
+// WithFailureBudget customizes how many items may fail before the processing is cancelled.
+func WithFailureBudget(budget int) Option {
+	return func(opts *mapReduceOptions) {
+		opts.failureBudget = budget
+	}
+}
+
+// WithProgress customizes the callback that reports processed and failed counts.
+func WithProgress(fn ProgressFunc) Option {
+	return func(opts *mapReduceOptions) {
+		opts.progress = fn
+	}
+}
+
+// newItemPolicy returns nil if none of the item options is set.
+func newItemPolicy(options *mapReduceOptions) *itemPolicy {
+	if options.retries <= 0 && options.itemTimeout <= 0 &&
+		options.failureBudget <= 0 && options.progress == nil {
+		return nil
+	}
+
+	return &itemPolicy{
+		retries:  options.retries,
+		backoff:  options.backoff,
+		timeout:  options.itemTimeout,
+		budget:   options.failureBudget,
+		progress: options.progress,
+	}
+}
+
+// runItem runs fn with the policy, writes of a failed attempt are discarded.
+// It returns an error only if the processing should be cancelled.
+func runItem[U any](ctx context.Context, p *itemPolicy, writer Writer[U],
+	fn func(ctx context.Context, writer Writer[U]) error) error {
+	if p == nil {
+		return fn(ctx, writer)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		buf := &sliceWriter[U]{}
+		if err = attemptItem[U](ctx, p.timeout, buf, fn); err == nil {
+			for _, v := range buf.items {
+				writer.Write(v)
+			}
+			break
+		}
+		if attempt >= p.retries || !sleepContext(ctx, p.backoff<<attempt) {
+			break
+		}
+	}
+
+	return p.done(err)
+}
+
+func attemptItem[U any](ctx context.Context, timeout time.Duration, writer Writer[U],
+	fn func(ctx context.Context, writer Writer[U]) error) error {
+	if timeout <= 0 {
+		return fn(ctx, writer)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(ctx, writer)
+	// mapper 没有处理 ctx 时，超时的结果同样视为失败
+	if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = context.DeadlineExceeded
+	}
+	return err
+}
+
+// done 记录 item 的结果，超出失败预算时返回错误
+func (p *itemPolicy) done(err error) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err == nil {
+		p.stat.Processed++
+	} else {
+		p.stat.Failed++
+	}
+	if p.progress != nil {
+		p.progress(p.stat)
+	}
+	if err != nil && p.stat.Failed > p.budget {
+		return err
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,112 @@
+package mr
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestForEachRetry(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var attempts [10]int32
+	err := ForEach(func(source chan<- int) {
+		for i := 0; i < 10; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int) error {
+		// 每个 item 前两次都失败
+		if atomic.AddInt32(&attempts[item], 1) < 3 {
+			return errDummy
+		}
+		return nil
+	}, WithRetry(2, time.Millisecond))
+	assert.Nil(t, err)
+	for i := range attempts {
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts[i]))
+	}
+}
+
+func TestForEachFailureBudget(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var lock sync.Mutex
+	var last Progress
+	err := ForEach(func(source chan<- int) {
+		for i := 0; i < 10; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int) error {
+		if item%5 == 0 {
+			return errDummy
+		}
+		return nil
+	}, WithFailureBudget(2), WithProgress(func(p Progress) {
+		lock.Lock()
+		last = p
+		lock.Unlock()
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, Progress{Processed: 8, Failed: 2}, last)
+
+	err = ForEach(func(source chan<- int) {
+		for i := 0; i < 10; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int) error {
+		if item%5 == 0 {
+			return errDummy
+		}
+		return nil
+	}, WithFailureBudget(1), WithWorkers(1))
+	assert.Equal(t, errDummy, err)
+}
+
+func TestMapReduceItemTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var attempts int32
+	val, err := MapReduce(func(source chan<- int) {
+		for i := 1; i <= 4; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		// item 1 的第一次执行超时，写入的数据需要被丢弃
+		if item == 1 && atomic.AddInt32(&attempts, 1) == 1 {
+			writer.Write(100)
+			<-ctx.Done()
+			return
+		}
+		writer.Write(item)
+	}, func(pipe <-chan int, writer Writer[int], cancel func(error)) {
+		var sum int
+		for v := range pipe {
+			sum += v
+		}
+		writer.Write(sum)
+	}, WithItemTimeout(20*time.Millisecond), WithRetry(1, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, val)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestMapReduceVoidRetryExhausted(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var attempts int32
+	err := MapReduceVoid(func(source chan<- int) {
+		source <- 1
+	}, func(ctx context.Context, item int, writer Writer[int], cancel func(error)) {
+		atomic.AddInt32(&attempts, 1)
+		cancel(errDummy)
+	}, func(pipe <-chan int, cancel func(error)) {
+		drain(pipe)
+	}, WithRetry(3, 0))
+	assert.Equal(t, errDummy, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&attempts))
+}
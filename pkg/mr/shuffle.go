@@ -0,0 +1,361 @@
+package mr
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+type (
+	// EmitFunc is used by keyed mappers to emit a key/value pair.
+	EmitFunc[V any] func(key string, value V)
+	// KeyedMapperFunc is used to do element processing and emit key/value pairs.
+	KeyedMapperFunc[T, V any] func(ctx context.Context, item T, emit EmitFunc[V])
+	// KeyedReducerFunc is used to reduce all the values of the same key and write to writer.
+	KeyedReducerFunc[V, R any] func(ctx context.Context, key string, values []V, writer Writer[R])
+
+	// record is an encoded key/value pair
+	record struct {
+		key  string
+		data []byte
+	}
+
+	// partition 内存中的记录超过预算后，排序写入临时文件
+	partition struct {
+		records []record
+		size    int
+		runs    []string
+	}
+
+	shuffler struct {
+		dir        string
+		limit      int
+		spills     int
+		partitions []*partition
+	}
+
+	sliceWriter[T any] struct {
+		items []T
+	}
+)
+
+// WithPartitions customizes the number of reduce partitions of MapReduceByKey.
+func WithPartitions(partitions int) Option {
+	return func(opts *mapReduceOptions) {
+		if partitions < minWorkers {
+			opts.partitions = minWorkers
+		} else {
+			opts.partitions = partitions
+		}
+	}
+}
+
+// WithMemoryLimit customizes how many bytes MapReduceByKey keeps in memory
+// before spilling sorted runs to disk.
+func WithMemoryLimit(limit int) Option {
+	return func(opts *mapReduceOptions) {
+		opts.memoryLimit = limit
+	}
+}
+
+// WithTempDir customizes the directory that MapReduceByKey spills into.
+func WithTempDir(dir string) Option {
+	return func(opts *mapReduceOptions) {
+		opts.tempDir = dir
+	}
+}
+
+// MapReduceByKey maps all elements generated from given generate into key/value pairs,
+// shuffles them into partitions by key hash, and reduces the values of each key.
+// Partitions are reduced concurrently, the output is ordered by partition and then by key.
+func MapReduceByKey[T, V, R any](generate GenerateFunc[T], mapper KeyedMapperFunc[T, V],
+	reducer KeyedReducerFunc[V, R], opts ...Option) ([]R, error) {
+	options := buildOptions(opts...)
+	dir, err := os.MkdirTemp(options.tempDir, "mr-shuffle")
+	if err != nil {
+		return nil, fmt.Errorf("create shuffle dir err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newShuffler(dir, options.partitions, options.memoryLimit)
+	// 记录经过 writer 交给单个 reducer 写入 partition，失败重试的 item 不会重复写入
+	err = MapReduceVoid(generate, func(ctx context.Context, item T, writer Writer[record], cancel func(error)) {
+		mapper(ctx, item, func(key string, value V) {
+			data, err := jsoniter.Marshal(value)
+			if err != nil {
+				cancel(fmt.Errorf("marshal value of key %s err: %s", key, err))
+				return
+			}
+			writer.Write(record{key: key, data: data})
+		})
+	}, func(pipe <-chan record, cancel func(error)) {
+		for r := range pipe {
+			if err := s.emit(r.key, r.data); err != nil {
+				cancel(err)
+				return
+			}
+		}
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]sliceWriter[R], len(s.partitions))
+	err = MapReduceVoid(func(source chan<- int) {
+		for i := range s.partitions {
+			source <- i
+		}
+	}, func(ctx context.Context, i int, _ Writer[any], cancel func(error)) {
+		err := s.partitions[i].iterate(func(key string, values [][]byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			vals := make([]V, len(values))
+			for j, data := range values {
+				if err := jsoniter.Unmarshal(data, &vals[j]); err != nil {
+					return fmt.Errorf("unmarshal value of key %s err: %s", key, err)
+				}
+			}
+			reducer(ctx, key, vals, &outputs[i])
+			return nil
+		})
+		if err != nil {
+			cancel(err)
+		}
+	}, func(pipe <-chan any, cancel func(error)) {
+		drain(pipe)
+	}, WithContext(options.ctx), WithWorkers(len(s.partitions)))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []R
+	for _, output := range outputs {
+		results = append(results, output.items...)
+	}
+	return results, nil
+}
+
+func newShuffler(dir string, partitions, limit int) *shuffler {
+	// 内存预算平均分给每个 partition
+	limit /= partitions
+	if limit < 1 {
+		limit = 1
+	}
+	s := &shuffler{
+		dir:        dir,
+		limit:      limit,
+		partitions: make([]*partition, partitions),
+	}
+	for i := range s.partitions {
+		s.partitions[i] = &partition{}
+	}
+	return s
+}
+
+// emit 只在 reducer 协程中调用，不需要加锁
+func (s *shuffler) emit(key string, data []byte) error {
+	i := hash.Murmur332([]byte(key), hash.DefaultSeed) % uint32(len(s.partitions))
+	p := s.partitions[i]
+	p.records = append(p.records, record{key: key, data: data})
+	p.size += len(key) + len(data)
+	if p.size < s.limit {
+		return nil
+	}
+
+	s.spills++
+	return p.spill(filepath.Join(s.dir, fmt.Sprintf("run%05d", s.spills)))
+}
+
+// spill 将排序后的记录写入 path
+func (p *partition) spill(path string) error {
+	p.sort()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create run file err: %s", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, r := range p.records {
+		for _, b := range [][]byte{[]byte(r.key), r.data} {
+			n := binary.PutUvarint(buf, uint64(len(b)))
+			if _, err = writer.Write(buf[:n]); err != nil {
+				return fmt.Errorf("write run file err: %s", err)
+			}
+			if _, err = writer.Write(b); err != nil {
+				return fmt.Errorf("write run file err: %s", err)
+			}
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("flush run file err: %s", err)
+	}
+
+	p.runs = append(p.runs, path)
+	p.records = nil
+	p.size = 0
+	return nil
+}
+
+func (p *partition) sort() {
+	// 稳定排序，同一个 key 的值保持写入顺序
+	sort.SliceStable(p.records, func(i, j int) bool {
+		return p.records[i].key < p.records[j].key
+	})
+}
+
+// iterate k 路归并所有 run 和内存中的记录，按 key 分组回调 fn
+func (p *partition) iterate(fn func(key string, values [][]byte) error) error {
+	p.sort()
+
+	sources := make([]recordSource, 0, len(p.runs)+1)
+	for _, path := range p.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open run file err: %s", err)
+		}
+		defer file.Close()
+		sources = append(sources, &runReader{reader: bufio.NewReader(file)})
+	}
+	sources = append(sources, &sliceReader{records: p.records})
+
+	h := &mergeHeap{}
+	for i, source := range sources {
+		if err := h.pushNext(source, i); err != nil {
+			return err
+		}
+	}
+
+	var key string
+	var values [][]byte
+	for h.Len() > 0 {
+		item := heap.Pop(h).(mergeItem)
+		if len(values) > 0 && item.key != key {
+			if err := fn(key, values); err != nil {
+				return err
+			}
+			values = nil
+		}
+		key = item.key
+		values = append(values, item.data)
+		if err := h.pushNext(sources[item.source], item.source); err != nil {
+			return err
+		}
+	}
+	if len(values) > 0 {
+		return fn(key, values)
+	}
+	return nil
+}
+
+type (
+	recordSource interface {
+		next() (record, bool, error)
+	}
+
+	runReader struct {
+		reader *bufio.Reader
+	}
+
+	sliceReader struct {
+		records []record
+	}
+
+	mergeItem struct {
+		record
+		source int
+	}
+
+	mergeHeap []mergeItem
+)
+
+func (r *runReader) next() (record, bool, error) {
+	key, err := r.read()
+	if err == io.EOF {
+		return record{}, false, nil
+	} else if err != nil {
+		return record{}, false, err
+	}
+	data, err := r.read()
+	if err != nil {
+		return record{}, false, err
+	}
+	return record{key: string(key), data: data}, true, nil
+}
+
+func (r *runReader) read() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(r.reader, buf); err != nil {
+		return nil, fmt.Errorf("read run file err: %s", err)
+	}
+	return buf, nil
+}
+
+func (r *sliceReader) next() (record, bool, error) {
+	if len(r.records) == 0 {
+		return record{}, false, nil
+	}
+	rec := r.records[0]
+	r.records = r.records[1:]
+	return rec, true, nil
+}
+
+func (h *mergeHeap) pushNext(source recordSource, i int) error {
+	rec, ok, err := source.next()
+	if err != nil {
+		return err
+	}
+	if ok {
+		heap.Push(h, mergeItem{record: rec, source: i})
+	}
+	return nil
+}
+
+func (h mergeHeap) Len() int {
+	return len(h)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	// 先写入的 run 排在前面
+	return h[i].source < h[j].source
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	*h = append(*h, x.(mergeItem))
+}
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func (w *sliceWriter[T]) Write(v T) {
+	w.items = append(w.items, v)
+}
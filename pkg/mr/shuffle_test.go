@@ -0,0 +1,109 @@
+package mr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type wordCount struct {
+	word  string
+	count int
+}
+
+func TestMapReduceByKey(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	lines := []string{
+		"the quick brown fox",
+		"jumps over the lazy dog",
+		"the dog barks",
+	}
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{name: "memory", limit: defaultMemoryLimit},
+		{name: "spill", limit: 16},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result, err := MapReduceByKey(func(source chan<- string) {
+				for i := 0; i < 100; i++ {
+					for _, line := range lines {
+						source <- line
+					}
+				}
+			}, func(ctx context.Context, line string, emit EmitFunc[int]) {
+				for _, word := range strings.Fields(line) {
+					emit(word, 1)
+				}
+			}, func(ctx context.Context, key string, values []int, writer Writer[wordCount]) {
+				var count int
+				for _, v := range values {
+					count += v
+				}
+				writer.Write(wordCount{word: key, count: count})
+			}, WithPartitions(3), WithMemoryLimit(test.limit), WithTempDir(dir))
+			assert.Nil(t, err)
+
+			counts := make(map[string]int)
+			for _, wc := range result {
+				_, ok := counts[wc.word]
+				assert.False(t, ok, "key %s reduced twice", wc.word)
+				counts[wc.word] = wc.count
+			}
+			assert.Equal(t, 9, len(counts))
+			assert.Equal(t, 300, counts["the"])
+			assert.Equal(t, 200, counts["dog"])
+			assert.Equal(t, 100, counts["fox"])
+
+			// 临时文件需要被清理
+			entries, err := os.ReadDir(dir)
+			assert.Nil(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestMapReduceByKeyOrder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	result, err := MapReduceByKey(func(source chan<- int) {
+		for i := 0; i < 50; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int, emit EmitFunc[int]) {
+		emit(fmt.Sprintf("k%02d", item%10), item)
+	}, func(ctx context.Context, key string, values []int, writer Writer[string]) {
+		sort.Ints(values)
+		writer.Write(fmt.Sprintf("%s:%v", key, values))
+	}, WithPartitions(1), WithMemoryLimit(32), WithWorkers(4))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(result))
+	assert.True(t, sort.StringsAreSorted(result))
+	assert.Equal(t, "k00:[0 10 20 30 40]", result[0])
+}
+
+func TestMapReduceByKeyPanic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	_, err := MapReduceByKey(func(source chan<- int) {
+		for i := 0; i < 10; i++ {
+			source <- i
+		}
+	}, func(ctx context.Context, item int, emit EmitFunc[int]) {
+		emit("key", item)
+	}, func(ctx context.Context, key string, values []int, writer Writer[int]) {
+		panic("foo")
+	})
+	assertPanicError(t, "foo", err)
+}
@@ -0,0 +1,411 @@
+package resource
+
+//
+// generic resource pool, e.g. connections, file handles or buffers
+// https://github.com/golang/go/blob/master/src/database/sql/sql.go
+//
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Get after the pool is closed.
+	ErrClosed = errors.New("resource pool closed")
+	// ErrTooManyWaiters is returned by Get when too many requests are waiting for a resource.
+	ErrTooManyWaiters = errors.New("too many waiting requests")
+)
+
+// Order is the order in which idle resources are reused
+type Order int
+
+const (
+	// LIFO reuses the most recently returned resource, so the rest can expire
+	LIFO Order = iota
+	// FIFO reuses the least recently returned resource, so the resources are used evenly
+	FIFO
+)
+
+// Config is a set of configuration for a resource pool
+type Config[R any] struct {
+	// Factory creates a resource, it is required.
+	Factory func(ctx context.Context) (R, error)
+	// Validate checks an idle resource before handing it out, an invalid one is destroyed.
+	Validate func(r R) error
+	// Destroy releases a resource which is removed from the pool.
+	Destroy func(r R)
+	// MaxOpen is the maximum number of open resources, 0 means unlimited.
+	MaxOpen int
+	// MaxIdle is the maximum number of idle resources, 0 means no idle resources are kept.
+	MaxIdle int
+	// MaxWaiting is the maximum number of requests waiting for a resource, 0 means unlimited.
+	MaxWaiting int
+	// MaxLifetime is the maximum amount of time a resource may be reused, 0 means forever.
+	MaxLifetime time.Duration
+	// MaxIdleTime is the maximum amount of time a resource may be idle, 0 means forever.
+	MaxIdleTime time.Duration
+	// ReapInterval is how often expired idle resources are destroyed in the background,
+	// defaults to half of the smaller of MaxLifetime and MaxIdleTime.
+	ReapInterval time.Duration
+	// Order is the order in which idle resources are reused, defaults to LIFO.
+	Order Order
+}
+
+// Stats is the statistics of a resource pool
+type Stats struct {
+	Open    int // open resources, in use or idle
+	Idle    int // idle resources
+	InUse   int // resources in use
+	Waiting int // requests waiting for a resource
+}
+
+// Pool is a pool of resources of type R
+type Pool[R any] struct {
+	cfg      Config[R]
+	mu       sync.Mutex // mutex to prevent race conditions
+	idle     []*Resource[R]
+	numOpen  int // counter that tracks open resources
+	closed   bool
+	stop     chan struct{} // stops the reaper
+	requests []*request[R] // A queue of resource requests, served in FIFO order
+}
+
+// Resource is a resource borrowed from the pool, it must be returned by Release or Destroy
+type Resource[R any] struct {
+	value     R
+	pool      *Pool[R]
+	createdAt time.Time // When the resource was created
+	idleSince time.Time // When the resource was returned to the pool
+	inUse     bool
+}
+
+// request wraps a channel to receive a resource or an error,
+// the channel is closed if the pool is closed
+type request[R any] struct {
+	ch chan result[R]
+}
+
+type result[R any] struct {
+	res *Resource[R]
+	err error
+}
+
+// New creates a resource pool and starts the reaper if resources expire
+func New[R any](cfg Config[R]) *Pool[R] {
+	p := &Pool[R]{
+		cfg:  cfg,
+		stop: make(chan struct{}),
+	}
+	if interval := reapInterval(&cfg); interval > 0 {
+		go p.reap(interval)
+	}
+	return p
+}
+
+// Value returns the underlying resource
+func (r *Resource[R]) Value() R {
+	return r.value
+}
+
+// Release returns the resource to the pool, it is a no-op if the resource is returned
+func (r *Resource[R]) Release() {
+	r.pool.put(r)
+}
+
+// Destroy removes the resource from the pool and destroys it
+func (r *Resource[R]) Destroy() {
+	p := r.pool
+	p.mu.Lock()
+	if !r.inUse {
+		p.mu.Unlock()
+		return
+	}
+	r.inUse = false
+	p.numOpen--
+	p.maybeOpenNewResources()
+	p.mu.Unlock()
+
+	p.destroy(r)
+}
+
+// Get retrieves a resource, waiting until one is available or ctx is done
+func (p *Pool[R]) Get(ctx context.Context) (*Resource[R], error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		// Case 1: Gets an idle resource from the pool if any
+		if r := p.popIdle(); r != nil {
+			r.inUse = true
+			p.mu.Unlock()
+			// Validate outside the lock, it may do I/O
+			if p.expired(r, time.Now()) || (p.cfg.Validate != nil && p.cfg.Validate(r.value) != nil) {
+				r.Destroy()
+				continue
+			}
+			return r, nil
+		}
+
+		// Case 2: Queue a resource request
+		if p.cfg.MaxOpen > 0 && p.numOpen >= p.cfg.MaxOpen {
+			if p.cfg.MaxWaiting > 0 && len(p.requests) >= p.cfg.MaxWaiting {
+				p.mu.Unlock()
+				return nil, ErrTooManyWaiters
+			}
+			req := &request[R]{ch: make(chan result[R], 1)}
+			p.requests = append(p.requests, req)
+			p.mu.Unlock()
+			return p.wait(ctx, req)
+		}
+
+		// Case 3: Create a new resource
+		p.numOpen++
+		p.mu.Unlock()
+
+		r, err := p.open(ctx)
+		if err != nil {
+			p.mu.Lock()
+			p.numOpen--
+			p.maybeOpenNewResources()
+			p.mu.Unlock()
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+// Close destroys the idle resources, fails the waiting requests and stops the reaper,
+// resources in use are destroyed when they are returned
+func (p *Pool[R]) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+
+	idle := p.idle
+	p.idle = nil
+	p.numOpen -= len(idle)
+	for _, req := range p.requests {
+		close(req.ch)
+	}
+	p.requests = nil
+	p.mu.Unlock()
+
+	for _, r := range idle {
+		p.destroy(r)
+	}
+	return nil
+}
+
+// Stats returns the statistics of the pool
+func (p *Pool[R]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Stats{
+		Open:    p.numOpen,
+		Idle:    len(p.idle),
+		InUse:   p.numOpen - len(p.idle),
+		Waiting: len(p.requests),
+	}
+}
+
+// wait() waits for the request to be fulfilled, or ctx to be done
+func (p *Pool[R]) wait(ctx context.Context, req *request[R]) (*Resource[R], error) {
+	select {
+	case <-ctx.Done():
+		p.mu.Lock()
+		removed := p.removeRequest(req)
+		p.mu.Unlock()
+		if !removed {
+			// The request is being fulfilled, return the resource to the pool
+			go func() {
+				if ret, ok := <-req.ch; ok && ret.res != nil {
+					p.put(ret.res)
+				}
+			}()
+		}
+		return nil, ctx.Err()
+	case ret, ok := <-req.ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return ret.res, ret.err
+	}
+}
+
+// put() returns a resource to the pool, it hands the resource to a waiting request first,
+// and destroys it if it can't be kept
+func (p *Pool[R]) put(r *Resource[R]) {
+	p.mu.Lock()
+	if !r.inUse {
+		p.mu.Unlock()
+		return
+	}
+
+	r.idleSince = time.Now()
+	if !p.closed && !p.expired(r, r.idleSince) {
+		if len(p.requests) > 0 {
+			req := p.requests[0]
+			p.requests = p.requests[1:]
+			req.ch <- result[R]{res: r} // buffered, never blocks
+			p.mu.Unlock()
+			return
+		}
+		if p.cfg.MaxIdle > len(p.idle) {
+			r.inUse = false
+			p.idle = append(p.idle, r) // put into the pool
+			p.mu.Unlock()
+			return
+		}
+	}
+
+	r.inUse = false
+	p.numOpen--
+	p.maybeOpenNewResources()
+	p.mu.Unlock()
+
+	p.destroy(r)
+}
+
+// popIdle() takes an idle resource in the configured order, p.mu must be held
+func (p *Pool[R]) popIdle() *Resource[R] {
+	n := len(p.idle)
+	if n == 0 {
+		return nil
+	}
+	var r *Resource[R]
+	if p.cfg.Order == FIFO {
+		r = p.idle[0]
+		p.idle[0] = nil
+		p.idle = p.idle[1:]
+	} else {
+		r = p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+	}
+	return r
+}
+
+// removeRequest() removes a request from the queue, p.mu must be held
+// It returns false if the request is not queued, which means it is being fulfilled
+func (p *Pool[R]) removeRequest(req *request[R]) bool {
+	for i, r := range p.requests {
+		if r == req {
+			p.requests = append(p.requests[:i], p.requests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// maybeOpenNewResources() creates resources for the waiting requests
+// if the number of open resources dropped below the limit, p.mu must be held
+func (p *Pool[R]) maybeOpenNewResources() {
+	if p.closed {
+		return
+	}
+	for len(p.requests) > 0 && (p.cfg.MaxOpen <= 0 || p.numOpen < p.cfg.MaxOpen) {
+		req := p.requests[0]
+		p.requests = p.requests[1:]
+		p.numOpen++
+		go p.openForRequest(req)
+	}
+}
+
+// openForRequest() creates a new resource and hands it to a waiting request
+func (p *Pool[R]) openForRequest(req *request[R]) {
+	r, err := p.open(context.Background())
+	if err != nil {
+		p.mu.Lock()
+		p.numOpen--
+		p.mu.Unlock()
+	}
+	req.ch <- result[R]{res: r, err: err}
+}
+
+// open() creates a new resource, the caller has counted it in numOpen
+func (p *Pool[R]) open(ctx context.Context) (*Resource[R], error) {
+	value, err := p.cfg.Factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Resource[R]{
+		value:     value,
+		pool:      p,
+		createdAt: time.Now(),
+		inUse:     true,
+	}, nil
+}
+
+func (p *Pool[R]) destroy(r *Resource[R]) {
+	if p.cfg.Destroy != nil {
+		p.cfg.Destroy(r.value)
+	}
+}
+
+// expired() reports whether a resource exceeds the max lifetime or the max idle time
+func (p *Pool[R]) expired(r *Resource[R], now time.Time) bool {
+	if p.cfg.MaxLifetime > 0 && now.Sub(r.createdAt) >= p.cfg.MaxLifetime {
+		return true
+	}
+	return p.cfg.MaxIdleTime > 0 && !r.idleSince.IsZero() && now.Sub(r.idleSince) >= p.cfg.MaxIdleTime
+}
+
+// reap() destroys expired idle resources periodically until the pool is closed
+func (p *Pool[R]) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-p.stop:
+			return
+		case now = <-ticker.C:
+		}
+
+		var expired []*Resource[R]
+		p.mu.Lock()
+		idle := p.idle[:0]
+		for _, r := range p.idle {
+			if p.expired(r, now) {
+				expired = append(expired, r)
+			} else {
+				idle = append(idle, r)
+			}
+		}
+		for i := len(idle); i < len(p.idle); i++ {
+			p.idle[i] = nil
+		}
+		p.idle = idle
+		p.numOpen -= len(expired)
+		p.maybeOpenNewResources()
+		p.mu.Unlock()
+
+		for _, r := range expired {
+			p.destroy(r)
+		}
+	}
+}
+
+// reapInterval() returns the interval of the reaper, 0 means no reaper
+func reapInterval[R any](cfg *Config[R]) time.Duration {
+	if cfg.ReapInterval > 0 {
+		return cfg.ReapInterval
+	}
+	interval := cfg.MaxLifetime
+	if cfg.MaxIdleTime > 0 && (interval == 0 || cfg.MaxIdleTime < interval) {
+		interval = cfg.MaxIdleTime
+	}
+	return interval / 2
+}
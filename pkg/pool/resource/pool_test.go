@@ -0,0 +1,244 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// counter creates increasing ints and records the destroyed ones
+type counter struct {
+	mu        sync.Mutex
+	next      int
+	destroyed []int
+}
+
+func (c *counter) config() Config[int] {
+	return Config[int]{
+		Factory: func(ctx context.Context) (int, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.next++
+			return c.next, nil
+		},
+		Destroy: func(r int) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.destroyed = append(c.destroyed, r)
+		},
+		MaxIdle: 4,
+	}
+}
+
+func (c *counter) destroyedList() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.destroyed...)
+}
+
+func getN(t *testing.T, p *Pool[int], n int) []*Resource[int] {
+	resources := make([]*Resource[int], n)
+	for i := range resources {
+		r, err := p.Get(context.Background())
+		assert.Nil(t, err)
+		resources[i] = r
+	}
+	return resources
+}
+
+func TestOrder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	for _, tt := range []struct {
+		order Order
+		want  int
+	}{
+		{LIFO, 3},
+		{FIFO, 1},
+	} {
+		c := &counter{}
+		cfg := c.config()
+		cfg.Order = tt.order
+		p := New(cfg)
+
+		for _, r := range getN(t, p, 3) {
+			r.Release()
+		}
+		r, err := p.Get(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, r.Value())
+		r.Release()
+		assert.Equal(t, Stats{Open: 3, Idle: 3}, p.Stats())
+		assert.Nil(t, p.Close())
+		assert.ElementsMatch(t, []int{1, 2, 3}, c.destroyedList())
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := &counter{}
+	cfg := c.config()
+	cfg.MaxIdle = 1
+	p := New(cfg)
+	defer p.Close()
+
+	resources := getN(t, p, 3)
+	assert.Equal(t, Stats{Open: 3, InUse: 3}, p.Stats())
+	for _, r := range resources {
+		r.Release()
+	}
+	// releasing twice is a no-op
+	resources[0].Release()
+	assert.Equal(t, Stats{Open: 1, Idle: 1}, p.Stats())
+	assert.Equal(t, []int{2, 3}, c.destroyedList())
+}
+
+func TestMaxOpen(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := &counter{}
+	cfg := c.config()
+	cfg.MaxOpen = 1
+	cfg.MaxWaiting = 1
+	p := New(cfg)
+	defer p.Close()
+
+	r1, err := p.Get(context.Background())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	got := make(chan *Resource[int])
+	go func() {
+		r, err := p.Get(context.Background())
+		assert.Nil(t, err)
+		got <- r
+	}()
+	assert.Eventually(t, func() bool { return p.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	_, err = p.Get(context.Background())
+	assert.Equal(t, ErrTooManyWaiters, err)
+
+	// the released resource is handed to the waiter
+	r1.Release()
+	r2 := <-got
+	assert.Equal(t, r1, r2)
+
+	// a destroyed resource makes room for a new one
+	go func() {
+		r, err := p.Get(context.Background())
+		assert.Nil(t, err)
+		got <- r
+	}()
+	assert.Eventually(t, func() bool { return p.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	r2.Destroy()
+	r3 := <-got
+	assert.Equal(t, 2, r3.Value())
+	r3.Release()
+	assert.Equal(t, Stats{Open: 1, Idle: 1}, p.Stats())
+}
+
+func TestValidate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := &counter{}
+	cfg := c.config()
+	cfg.Validate = func(r int) error {
+		if r == 1 {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+	p := New(cfg)
+	defer p.Close()
+
+	getN(t, p, 1)[0].Release()
+	r, err := p.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r.Value())
+	assert.Equal(t, []int{1}, c.destroyedList())
+}
+
+func TestFactoryError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	errFactory := errors.New("factory")
+	p := New(Config[int]{
+		Factory: func(ctx context.Context) (int, error) {
+			return 0, errFactory
+		},
+	})
+	defer p.Close()
+
+	_, err := p.Get(context.Background())
+	assert.Equal(t, errFactory, err)
+	assert.Equal(t, Stats{}, p.Stats())
+}
+
+func TestExpire(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := &counter{}
+	cfg := c.config()
+	cfg.MaxIdleTime = 20 * time.Millisecond
+	p := New(cfg)
+	defer p.Close()
+
+	for _, r := range getN(t, p, 3) {
+		r.Release()
+	}
+	assert.Equal(t, 3, p.Stats().Idle)
+	// the reaper destroys the expired idle resources
+	assert.Eventually(t, func() bool {
+		return p.Stats() == Stats{}
+	}, time.Second, 5*time.Millisecond)
+	assert.ElementsMatch(t, []int{1, 2, 3}, c.destroyedList())
+
+	cfg.MaxIdleTime = 0
+	cfg.MaxLifetime = 20 * time.Millisecond
+	cfg.ReapInterval = time.Hour
+	p2 := New(cfg)
+	defer p2.Close()
+	getN(t, p2, 1)[0].Release()
+	time.Sleep(cfg.MaxLifetime)
+	r, err := p2.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 5, r.Value())
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := &counter{}
+	cfg := c.config()
+	cfg.MaxOpen = 1
+	p := New(cfg)
+
+	r, err := p.Get(context.Background())
+	assert.Nil(t, err)
+	waitErr := make(chan error)
+	go func() {
+		_, err := p.Get(context.Background())
+		waitErr <- err
+	}()
+	assert.Eventually(t, func() bool { return p.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+	assert.Nil(t, p.Close())
+	assert.Nil(t, p.Close())
+	assert.Equal(t, ErrClosed, <-waitErr)
+	_, err = p.Get(context.Background())
+	assert.Equal(t, ErrClosed, err)
+
+	// resources in use are destroyed when released
+	r.Release()
+	assert.Equal(t, Stats{}, p.Stats())
+	assert.Equal(t, []int{1}, c.destroyedList())
+}
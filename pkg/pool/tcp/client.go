@@ -0,0 +1,296 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// request/response protocol on top of the length-prefixed frames
+// request:  | correlation id (8 bytes) | data |
+// response: | correlation id (8 bytes) | status (1 byte) | data or error message |
+//
+
+const (
+	idSize         = 8
+	responseHeader = idSize + 1
+
+	statusOK    byte = 0
+	statusError byte = 1
+)
+
+// ErrClientClosed is returned by Call after the client is closed.
+var ErrClientClosed = errors.New("tcp client closed")
+
+// ClientConfig is a set of configuration for a Client
+type ClientConfig struct {
+	// Conns is the number of pipelined connections, defaults to 1.
+	Conns int
+	// Timeout is the timeout of a call whose ctx has no deadline, 0 means no timeout.
+	Timeout time.Duration
+	// Retries is how many times a call is retried on a fresh connection
+	// when the connection breaks, requests must be idempotent to be retried.
+	Retries int
+}
+
+// RemoteError is the error returned by the handler of the server.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// connError is returned when the connection breaks, the call may be retried
+type connError struct {
+	err error
+}
+
+func (e *connError) Error() string {
+	return "connection broken: " + e.err.Error()
+}
+
+func (e *connError) Unwrap() error {
+	return e.err
+}
+
+// ConnPool provides connections to Client, e.g. TcpConnPool or Cluster
+type ConnPool interface {
+	Get(ctx context.Context) (*Conn, error)
+}
+
+// Client sends requests over connections of the pool, many requests can be in flight
+// on a connection at the same time, and responses are matched by correlation ids.
+type Client struct {
+	pool    ConnPool
+	timeout time.Duration
+	retries int
+	seq     uint64 // correlation id
+
+	mu     sync.Mutex
+	conns  []*muxConn
+	next   int
+	closed bool
+}
+
+// muxConn is a connection shared by concurrent calls
+type muxConn struct {
+	conn    *Conn
+	wmu     sync.Mutex // serializes writes
+	mu      sync.Mutex
+	pending map[uint64]chan callResult
+	err     error // set when the connection is broken
+}
+
+type callResult struct {
+	data []byte
+	err  error
+}
+
+// NewClient creates a client, cfg may be nil
+func NewClient(pool ConnPool, cfg *ClientConfig) *Client {
+	if cfg == nil {
+		cfg = &ClientConfig{}
+	}
+	conns := cfg.Conns
+	if conns < 1 {
+		conns = 1
+	}
+	return &Client{
+		pool:    pool,
+		timeout: cfg.Timeout,
+		retries: cfg.Retries,
+		conns:   make([]*muxConn, conns),
+	}
+}
+
+// Call sends the request and waits for the response until ctx is done
+func (c *Client) Call(ctx context.Context, req []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		var mc *muxConn
+		mc, err = c.conn(ctx)
+		if err != nil {
+			// 拨号时超时或者被取消，与请求超时返回相同的错误
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		var resp []byte
+		resp, err = mc.call(ctx, atomic.AddUint64(&c.seq, 1), req)
+		var ce *connError
+		if err == nil || !errors.As(err, &ce) || ctx.Err() != nil {
+			return resp, err
+		}
+	}
+	return nil, err
+}
+
+// Close closes the connections, calls in flight fail
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	conns := c.conns
+	c.mu.Unlock()
+
+	for _, mc := range conns {
+		if mc != nil {
+			mc.fail(ErrClientClosed)
+		}
+	}
+	return nil
+}
+
+// conn() picks a connection in round-robin, broken connections are replaced by fresh ones
+func (c *Client) conn(ctx context.Context) (*muxConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	i := c.next
+	c.next = (c.next + 1) % len(c.conns)
+	if mc := c.conns[i]; mc != nil && !mc.broken() {
+		c.mu.Unlock()
+		return mc, nil
+	}
+	c.mu.Unlock()
+
+	// Get a connection outside the lock, it may wait
+	pc, err := c.pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mc := newMuxConn(pc)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		mc.fail(ErrClientClosed)
+		return nil, ErrClientClosed
+	}
+	if old := c.conns[i]; old != nil && !old.broken() {
+		// Replaced by a concurrent call
+		mc.fail(ErrClientClosed)
+		return old, nil
+	}
+	c.conns[i] = mc
+	return mc, nil
+}
+
+func newMuxConn(conn *Conn) *muxConn {
+	mc := &muxConn{
+		conn:    conn,
+		pending: make(map[uint64]chan callResult),
+	}
+	go mc.readLoop()
+	return mc
+}
+
+// call() writes the request and waits for the response with the same id
+func (mc *muxConn) call(ctx context.Context, id uint64, req []byte) ([]byte, error) {
+	ch := make(chan callResult, 1)
+	mc.mu.Lock()
+	if mc.err != nil {
+		mc.mu.Unlock()
+		return nil, &connError{err: mc.err}
+	}
+	mc.pending[id] = ch
+	mc.mu.Unlock()
+
+	frame := make([]byte, idSize+len(req))
+	binary.BigEndian.PutUint64(frame[:idSize], id)
+	copy(frame[idSize:], req)
+
+	mc.wmu.Lock()
+	deadline, _ := ctx.Deadline()
+	err := mc.conn.SetWriteDeadline(deadline)
+	if err == nil {
+		err = mc.conn.WriteFrame(frame)
+	}
+	mc.wmu.Unlock()
+	if err != nil {
+		// A partial frame corrupts the connection
+		mc.fail(err)
+		return nil, &connError{err: err}
+	}
+
+	select {
+	case ret := <-ch:
+		return ret.data, ret.err
+	case <-ctx.Done():
+		mc.mu.Lock()
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop() dispatches responses to the pending calls until the connection breaks
+func (mc *muxConn) readLoop() {
+	for {
+		frame, err := mc.conn.ReadFrame()
+		if err == nil && len(frame) < responseHeader {
+			err = errBadFrame
+		}
+		if err != nil {
+			mc.fail(err)
+			return
+		}
+
+		id := binary.BigEndian.Uint64(frame[:idSize])
+		ret := callResult{data: frame[responseHeader:]}
+		if frame[idSize] != statusOK {
+			ret = callResult{err: &RemoteError{Message: string(ret.data)}}
+		}
+
+		mc.mu.Lock()
+		ch, ok := mc.pending[id]
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+		// The call may have timed out
+		if ok {
+			ch <- ret
+		}
+	}
+}
+
+// fail() breaks the connection, fails the pending calls and discards the connection
+func (mc *muxConn) fail(err error) {
+	mc.mu.Lock()
+	if mc.err != nil {
+		mc.mu.Unlock()
+		return
+	}
+	mc.err = err
+	pending := mc.pending
+	mc.pending = nil
+	mc.mu.Unlock()
+
+	for _, ch := range pending {
+		ch <- callResult{err: &connError{err: err}}
+	}
+	_ = mc.conn.Discard()
+}
+
+func (mc *muxConn) broken() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.err != nil
+}
@@ -0,0 +1,151 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler Handler, cfg *ClientConfig) (*Client, *TcpConnPool) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := NewServer(handler)
+	go func() { _ = server.Serve(l) }()
+
+	addr := l.Addr().(*net.TCPAddr)
+	pool, err := CreateTcpConnPool(&TcpConfig{
+		Host:         addr.IP.String(),
+		Port:         addr.Port,
+		MaxIdleConns: 4,
+		MaxOpenConn:  4,
+	})
+	assert.Nil(t, err)
+	client := NewClient(pool, cfg)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = pool.Close()
+		_ = server.Close()
+	})
+	return client, pool
+}
+
+func TestClientCall(t *testing.T) {
+	client, _ := newTestClient(t, func(req []byte) ([]byte, error) {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return append([]byte("echo:"), req...), nil
+	}, &ClientConfig{Conns: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Call(context.Background(), []byte(fmt.Sprint(i)))
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("echo:%d", i), string(resp))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientPipelining(t *testing.T) {
+	client, pool := newTestClient(t, func(req []byte) ([]byte, error) {
+		time.Sleep(50 * time.Millisecond)
+		return req, nil
+	}, nil)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Call(context.Background(), []byte("ping"))
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	// all requests are in flight on one connection at the same time
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+	numOpen, _ := pool.stats()
+	assert.Equal(t, 1, numOpen)
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := newTestClient(t, func(req []byte) ([]byte, error) {
+		if string(req) == "slow" {
+			<-release
+		}
+		return req, nil
+	}, &ClientConfig{Timeout: 20 * time.Millisecond})
+
+	_, err := client.Call(context.Background(), []byte("slow"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	close(release)
+
+	// the late response is dropped, the connection is still usable
+	resp, err := client.Call(context.Background(), []byte("fast"))
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", string(resp))
+}
+
+func TestClientRemoteError(t *testing.T) {
+	client, _ := newTestClient(t, func(req []byte) ([]byte, error) {
+		return nil, errors.New("bad request")
+	}, nil)
+
+	_, err := client.Call(context.Background(), []byte("ping"))
+	var remoteErr *RemoteError
+	assert.True(t, errors.As(err, &remoteErr))
+	assert.Equal(t, "bad request", remoteErr.Message)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	received := make(chan struct{})
+	release := make(chan struct{})
+	client, _ := newTestClient(t, func(req []byte) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(received)
+			<-release
+		}
+		return req, nil
+	}, &ClientConfig{Retries: 1})
+
+	go func() {
+		<-received
+		// break the connection while the call is in flight
+		client.mu.Lock()
+		_ = client.conns[0].conn.tc.conn.Close()
+		client.mu.Unlock()
+		close(release)
+	}()
+	resp, err := client.Call(context.Background(), []byte("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(resp))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestClientClose(t *testing.T) {
+	client, pool := newTestClient(t, func(req []byte) ([]byte, error) {
+		return req, nil
+	}, nil)
+
+	_, err := client.Call(context.Background(), []byte("ping"))
+	assert.Nil(t, err)
+	assert.Nil(t, client.Close())
+	_, err = client.Call(context.Background(), []byte("ping"))
+	assert.Equal(t, ErrClientClosed, err)
+	numOpen, _ := pool.stats()
+	assert.Equal(t, 0, numOpen)
+}
@@ -0,0 +1,331 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+const (
+	defaultVirtualNodes     = 100
+	defaultFailureThreshold = 5
+	defaultEjectionTime     = 30 * time.Second
+)
+
+// ErrNoEndpoint is returned when all the endpoints are ejected or failing.
+var ErrNoEndpoint = errors.New("no available endpoint")
+
+// Balance is the strategy to select an endpoint
+type Balance int
+
+const (
+	// RoundRobin selects the endpoints in turn
+	RoundRobin Balance = iota
+	// LeastConns selects the endpoint with the least connections in use
+	LeastConns
+	// ConsistentHash selects the endpoint by the key passed to GetKey,
+	// the same key goes to the same endpoint while it is available
+	ConsistentHash
+)
+
+// ClusterConfig is a set of configuration for a pool over several endpoints
+type ClusterConfig struct {
+	// Endpoints are the addresses of the backends, in the form of host:port.
+	Endpoints []string
+	// Pool is the configuration of the pool of every endpoint, Host and Port are ignored.
+	Pool TcpConfig
+	// Balance is the strategy to select an endpoint, defaults to RoundRobin.
+	Balance Balance
+	// VirtualNodes is the number of points of an endpoint on the hash ring, defaults to 100.
+	VirtualNodes int
+	// FailureThreshold is the number of consecutive failures that ejects an endpoint, defaults to 5.
+	FailureThreshold int
+	// EjectionTime is how long an endpoint is ejected before a trial request
+	// is let through to re-admit it, defaults to 30s.
+	EjectionTime time.Duration
+}
+
+// Cluster is a connection pool over several endpoints with load balancing,
+// an endpoint is ejected by a circuit breaker after consecutive connection failures.
+type Cluster struct {
+	endpoints []*endpoint
+	balance   Balance
+	ring      []ringNode // sorted by hash
+	next      uint64     // round-robin counter
+}
+
+type endpoint struct {
+	addr    string
+	pool    *TcpConnPool
+	inUse   int64
+	breaker *breaker
+}
+
+type ringNode struct {
+	hash     uint32
+	endpoint int
+}
+
+// breakerState is the state of a circuit breaker
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // requests pass through
+	breakerOpen                         // the endpoint is ejected
+	breakerHalfOpen                     // a trial request is in flight
+)
+
+// breaker is a circuit breaker counting consecutive failures
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	ejection  time.Duration
+	state     breakerState
+	failures  int
+	openUntil time.Time
+}
+
+// NewCluster creates pools for the endpoints
+func NewCluster(cfg *ClusterConfig) (*Cluster, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	ejection := cfg.EjectionTime
+	if ejection <= 0 {
+		ejection = defaultEjectionTime
+	}
+	virtualNodes := cfg.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+
+	c := &Cluster{
+		balance: cfg.Balance,
+	}
+	for i, addr := range cfg.Endpoints {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		poolCfg := cfg.Pool
+		poolCfg.Host = host
+		if poolCfg.Port, err = strconv.Atoi(port); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		pool, err := CreateTcpConnPool(&poolCfg)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, &endpoint{
+			addr:    addr,
+			pool:    pool,
+			breaker: &breaker{threshold: threshold, ejection: ejection},
+		})
+		for v := 0; v < virtualNodes; v++ {
+			c.ring = append(c.ring, ringNode{
+				hash:     hash.Murmur332([]byte(addr+"#"+strconv.Itoa(v)), hash.DefaultSeed),
+				endpoint: i,
+			})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool {
+		return c.ring[i].hash < c.ring[j].hash
+	})
+
+	return c, nil
+}
+
+// Get retrieves a connection from an endpoint selected by the balance strategy,
+// ConsistentHash falls back to RoundRobin since there is no key
+func (c *Cluster) Get(ctx context.Context) (*Conn, error) {
+	return c.get(ctx, nil)
+}
+
+// GetKey retrieves a connection from the endpoint of the key if the strategy
+// is ConsistentHash, the next endpoint on the ring is used if it is ejected
+func (c *Cluster) GetKey(ctx context.Context, key string) (*Conn, error) {
+	return c.get(ctx, &key)
+}
+
+// Close closes the pools of all the endpoints
+func (c *Cluster) Close() error {
+	for _, e := range c.endpoints {
+		_ = e.pool.Close()
+	}
+	return nil
+}
+
+// get() tries the endpoints in the order of the strategy, skipping ejected and failing ones.
+// Only dial errors and I/O errors of borrowed connections count as failures of an endpoint,
+// a saturated pool is skipped and a connection closed by the peer while idle is not a failure.
+func (c *Cluster) get(ctx context.Context, key *string) (*Conn, error) {
+	tried := make([]bool, len(c.endpoints))
+	for {
+		i, trial := c.pick(key, tried, time.Now())
+		if i < 0 {
+			return nil, ErrNoEndpoint
+		}
+		tried[i] = true
+		e := c.endpoints[i]
+
+		conn, err := e.pool.Get(ctx)
+		if err == nil && trial {
+			// an idle connection may be left from before the ejection,
+			// only a new or probed one proves the endpoint is reachable
+			conn, err = e.pool.verify(ctx, conn)
+		}
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case ctx.Err() != nil:
+				e.breaker.cancel()
+				return nil, err
+			case errors.As(err, &netErr):
+				e.breaker.failure(time.Now())
+			default:
+				e.breaker.cancel()
+			}
+			continue
+		}
+		// the trial got a working connection, re-admit the endpoint
+		e.breaker.admit()
+
+		atomic.AddInt64(&e.inUse, 1)
+		conn.release = func(failed bool) {
+			atomic.AddInt64(&e.inUse, -1)
+			if failed {
+				e.breaker.failure(time.Now())
+			} else {
+				e.breaker.success()
+			}
+		}
+		return conn, nil
+	}
+}
+
+// pick() selects an endpoint which is not tried and admitted by its breaker, -1 means none,
+// trial reports whether the request is the trial of an ejected endpoint
+func (c *Cluster) pick(key *string, tried []bool, now time.Time) (i int, trial bool) {
+	n := len(c.endpoints)
+	candidates := make([]int, 0, n)
+	switch {
+	case c.balance == ConsistentHash && key != nil:
+		// walk the ring clockwise from the hash of the key
+		h := hash.Murmur332([]byte(*key), hash.DefaultSeed)
+		start := sort.Search(len(c.ring), func(i int) bool {
+			return c.ring[i].hash >= h
+		})
+		seen := make([]bool, n)
+		for i := 0; i < len(c.ring) && len(candidates) < n; i++ {
+			node := c.ring[(start+i)%len(c.ring)]
+			if !seen[node.endpoint] {
+				seen[node.endpoint] = true
+				candidates = append(candidates, node.endpoint)
+			}
+		}
+	default:
+		start := int(atomic.AddUint64(&c.next, 1) % uint64(n))
+		for i := 0; i < n; i++ {
+			candidates = append(candidates, (start+i)%n)
+		}
+		if c.balance == LeastConns {
+			// stable, so the round-robin order breaks ties
+			sort.SliceStable(candidates, func(i, j int) bool {
+				return atomic.LoadInt64(&c.endpoints[candidates[i]].inUse) <
+					atomic.LoadInt64(&c.endpoints[candidates[j]].inUse)
+			})
+		}
+	}
+
+	for _, i := range candidates {
+		if tried[i] {
+			continue
+		}
+		if ok, trial := c.endpoints[i].breaker.allow(now); ok {
+			return i, trial
+		}
+	}
+	return -1, false
+}
+
+// allow() reports whether a request may go to the endpoint,
+// an open breaker lets one trial request through after the ejection time
+func (b *breaker) allow(now time.Time) (ok, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true, false
+	case breakerOpen:
+		if now.Before(b.openUntil) {
+			return false, false
+		}
+		b.state = breakerHalfOpen
+		return true, true
+	default: // a trial request is in flight
+		return false, false
+	}
+}
+
+// admit() closes a half-open breaker whose trial request succeeded
+func (b *breaker) admit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerClosed
+		b.failures = 0
+	}
+}
+
+// success() resets the failures of a closed breaker and closes a half-open one,
+// an open breaker ignores it, e.g. a connection borrowed before the ejection is returned
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		b.failures = 0
+	case breakerHalfOpen:
+		b.state = breakerClosed
+		b.failures = 0
+	}
+}
+
+// failure() opens the breaker after too many consecutive failures or a failed trial
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openUntil = now.Add(b.ejection)
+	}
+}
+
+// cancel() gives up a trial request whose result is unknown
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
@@ -0,0 +1,336 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCluster(t *testing.T, n int, cfg *ClusterConfig) *Cluster {
+	for i := 0; i < n; i++ {
+		server, _ := newTestServer(t)
+		cfg.Endpoints = append(cfg.Endpoints, net.JoinHostPort(server.Host, fmt.Sprint(server.Port)))
+	}
+	if cfg.Pool.MaxOpenConn == 0 {
+		cfg.Pool = TcpConfig{MaxIdleConns: 4, MaxOpenConn: 8}
+	}
+	cluster, err := NewCluster(cfg)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = cluster.Close() })
+	return cluster
+}
+
+func (c *Cluster) inUse() []int64 {
+	inUse := make([]int64, len(c.endpoints))
+	for i, e := range c.endpoints {
+		inUse[i] = atomic.LoadInt64(&e.inUse)
+	}
+	return inUse
+}
+
+// endpointOf returns the index of the endpoint of a connection
+func (c *Cluster) endpointOf(conn *Conn) int {
+	for i, e := range c.endpoints {
+		if e.pool == conn.tc.pool {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	cluster := newTestCluster(t, 3, &ClusterConfig{Balance: RoundRobin})
+
+	for i := 0; i < 6; i++ {
+		_, err := cluster.Get(context.Background())
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []int64{2, 2, 2}, cluster.inUse())
+}
+
+func TestClusterLeastConns(t *testing.T) {
+	cluster := newTestCluster(t, 3, &ClusterConfig{Balance: LeastConns})
+
+	conns := make([]*Conn, 3)
+	for range conns {
+		c, err := cluster.Get(context.Background())
+		assert.Nil(t, err)
+		conns[cluster.endpointOf(c)] = c
+	}
+	assert.Equal(t, []int64{1, 1, 1}, cluster.inUse())
+
+	assert.Nil(t, conns[1].Close())
+	c, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cluster.endpointOf(c))
+}
+
+func TestClusterConsistentHash(t *testing.T) {
+	cluster := newTestCluster(t, 3, &ClusterConfig{Balance: ConsistentHash})
+
+	used := map[int]bool{}
+	for k := 0; k < 20; k++ {
+		key := fmt.Sprintf("user-%d", k)
+		c, err := cluster.GetKey(context.Background(), key)
+		assert.Nil(t, err)
+		i := cluster.endpointOf(c)
+		used[i] = true
+		assert.Nil(t, c.Close())
+
+		// the same key goes to the same endpoint
+		for j := 0; j < 3; j++ {
+			c, err := cluster.GetKey(context.Background(), key)
+			assert.Nil(t, err)
+			assert.Equal(t, i, cluster.endpointOf(c))
+			assert.Nil(t, c.Close())
+		}
+	}
+	assert.Equal(t, 3, len(used))
+}
+
+func TestClusterEjection(t *testing.T) {
+	// start the live endpoints first, so they can not take the port of the dead one
+	endpoints := make([]string, 3)
+	for i := 1; i < len(endpoints); i++ {
+		server, _ := newTestServer(t)
+		endpoints[i] = net.JoinHostPort(server.Host, fmt.Sprint(server.Port))
+	}
+	// an endpoint which refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	deadAddr := l.Addr().String()
+	assert.Nil(t, l.Close())
+	endpoints[0] = deadAddr
+
+	cfg := &ClusterConfig{
+		Endpoints:        endpoints,
+		FailureThreshold: 1,
+		EjectionTime:     50 * time.Millisecond,
+	}
+	cluster := newTestCluster(t, 0, cfg)
+
+	for i := 0; i < 6; i++ {
+		c, err := cluster.Get(context.Background())
+		assert.Nil(t, err)
+		assert.NotEqual(t, 0, cluster.endpointOf(c))
+		assert.Nil(t, c.Close())
+	}
+	ok, _ := cluster.endpoints[0].breaker.allow(time.Now())
+	assert.False(t, ok)
+
+	// the endpoint comes back and is re-admitted after the ejection time
+	l, err = net.Listen("tcp", deadAddr)
+	assert.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			if _, err := l.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(cfg.EjectionTime)
+	assert.Eventually(t, func() bool {
+		c, err := cluster.Get(context.Background())
+		if err != nil {
+			return false
+		}
+		defer c.Close()
+		return cluster.endpointOf(c) == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, breakerClosed, cluster.endpoints[0].breaker.state)
+}
+
+func TestClusterPassiveEjection(t *testing.T) {
+	cluster := newTestCluster(t, 1, &ClusterConfig{FailureThreshold: 2, EjectionTime: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		c, err := cluster.Get(context.Background())
+		assert.Nil(t, err)
+		// a read error marks the connection bad
+		_ = c.SetReadDeadline(time.Now())
+		_, err = c.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		assert.Nil(t, c.Close())
+	}
+	_, err := cluster.Get(context.Background())
+	assert.Equal(t, ErrNoEndpoint, err)
+}
+
+func TestClusterTrialResolvedOnGet(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := l.Addr().String()
+	assert.Nil(t, l.Close())
+
+	cfg := &ClusterConfig{
+		Endpoints:        []string{addr},
+		FailureThreshold: 1,
+		EjectionTime:     50 * time.Millisecond,
+	}
+	cluster := newTestCluster(t, 0, cfg)
+	_, err = cluster.Get(context.Background())
+	assert.Equal(t, ErrNoEndpoint, err)
+
+	l, err = net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			if _, err := l.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(cfg.EjectionTime)
+
+	// the trial connection is held, like the mux connection of a Client
+	trial, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	defer trial.Close()
+	assert.Equal(t, breakerClosed, cluster.endpoints[0].breaker.state)
+
+	c, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+}
+
+func TestClusterSaturationNotFailure(t *testing.T) {
+	cfg := &ClusterConfig{
+		Pool:             TcpConfig{MaxOpenConn: 1},
+		FailureThreshold: 1,
+	}
+	cluster := newTestCluster(t, 1, cfg)
+	e := cluster.endpoints[0]
+
+	held, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+
+	// fill the wait queue of the endpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	for i := 0; i < maxQueueLength; i++ {
+		go func() {
+			if c, err := e.pool.Get(ctx); err == nil {
+				_ = c.Close()
+			}
+			done <- struct{}{}
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return e.pool.Stats().Waiting == maxQueueLength
+	}, time.Second, time.Millisecond)
+
+	_, err = cluster.Get(context.Background())
+	assert.Equal(t, ErrNoEndpoint, err)
+	ok, _ := e.breaker.allow(time.Now())
+	assert.True(t, ok)
+
+	cancel()
+	for i := 0; i < maxQueueLength; i++ {
+		<-done
+	}
+	assert.Nil(t, held.Close())
+}
+
+func TestClusterOpenIgnoresSuccess(t *testing.T) {
+	cluster := newTestCluster(t, 1, &ClusterConfig{FailureThreshold: 1, EjectionTime: time.Minute})
+
+	// borrowed before the endpoint is ejected
+	held, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+
+	c, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	_ = c.SetReadDeadline(time.Now())
+	_, err = c.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Nil(t, c.Close())
+
+	// returning a healthy connection does not re-admit the endpoint
+	assert.Nil(t, held.Close())
+	assert.Equal(t, breakerOpen, cluster.endpoints[0].breaker.state)
+	_, err = cluster.Get(context.Background())
+	assert.Equal(t, ErrNoEndpoint, err)
+}
+
+func TestClusterTrialSkipsStaleConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	cfg := &ClusterConfig{
+		Endpoints:        []string{l.Addr().String()},
+		Pool:             TcpConfig{MaxIdleConns: 1, MaxOpenConn: 2},
+		FailureThreshold: 1,
+		EjectionTime:     50 * time.Millisecond,
+	}
+	cluster := newTestCluster(t, 0, cfg)
+
+	idle, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	c, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, idle.Close())
+	_ = c.SetReadDeadline(time.Now())
+	_, err = c.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Nil(t, c.Close())
+	assert.Equal(t, breakerOpen, cluster.endpoints[0].breaker.state)
+
+	// the endpoint goes down, leaving a stale connection in the pool
+	assert.Nil(t, l.Close())
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, (<-accepted).Close())
+	}
+	time.Sleep(cfg.EjectionTime)
+
+	// the trial probes the stale connection and fails to dial a new one
+	_, err = cluster.Get(context.Background())
+	assert.Equal(t, ErrNoEndpoint, err)
+	assert.Equal(t, breakerOpen, cluster.endpoints[0].breaker.state)
+}
+
+func TestClusterIdleClosedByPeer(t *testing.T) {
+	server, accepted := newTestServer(t)
+	cfg := &ClusterConfig{
+		Endpoints:        []string{net.JoinHostPort(server.Host, fmt.Sprint(server.Port))},
+		Pool:             TcpConfig{MaxIdleConns: 1, MaxOpenConn: 1},
+		FailureThreshold: 1,
+	}
+	cluster := newTestCluster(t, 0, cfg)
+
+	c, err := cluster.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+	// the peer closes the idle connection
+	assert.Nil(t, (<-accepted).Close())
+
+	c, err = cluster.Get(context.Background())
+	assert.Nil(t, err)
+	_ = c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, c.Close())
+
+	// the endpoint is not ejected and a new connection is dialed
+	assert.Equal(t, breakerClosed, cluster.endpoints[0].breaker.state)
+	c, err = cluster.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package tcp
+
+import "net"
+
+// defaultProbe() falls back to a read with a short deadline
+func defaultProbe(conn net.Conn) error {
+	return readProbe(conn)
+}
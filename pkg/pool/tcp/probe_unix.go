@@ -0,0 +1,46 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package tcp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// defaultProbe() peeks the socket without blocking, a healthy idle connection
+// has nothing to read, so EOF, errors or unexpected data mean it is unusable
+func defaultProbe(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return readProbe(conn)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var (
+		n       int
+		peekErr error
+		buf     [1]byte
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		n, _, peekErr = syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		return true // 不等待可读
+	})
+	switch {
+	case err != nil:
+		return err
+	case errors.Is(peekErr, syscall.EAGAIN) || errors.Is(peekErr, syscall.EWOULDBLOCK):
+		return nil
+	case peekErr != nil:
+		return peekErr
+	case n > 0:
+		return errUnexpectedRead
+	default:
+		return io.EOF
+	}
+}
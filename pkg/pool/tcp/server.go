@@ -0,0 +1,133 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrServerClosed is returned by Serve after the server is closed.
+var ErrServerClosed = errors.New("tcp server closed")
+
+// Handler handles a request and returns the response, an error is sent back as a RemoteError
+type Handler func(req []byte) ([]byte, error)
+
+// Server serves the requests of Client, the requests on a connection are handled
+// concurrently, so the responses may be sent out of order.
+type Server struct {
+	handler   Handler
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a server
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler:   handler,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on the listener until the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(c)
+	}
+}
+
+// Close closes the listeners and the connections, and waits for the handlers
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn() reads requests until the connection is closed
+func (s *Server) serveConn(c net.Conn) {
+	var (
+		wmu      sync.Mutex // serializes responses
+		handlers sync.WaitGroup
+	)
+	defer func() {
+		handlers.Wait()
+		_ = c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	for {
+		frame, err := readFrame(c)
+		if err != nil || len(frame) < idSize {
+			return
+		}
+
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+
+			status := statusOK
+			data, err := s.handler(frame[idSize:])
+			if err != nil {
+				status = statusError
+				data = []byte(err.Error())
+			}
+			resp := make([]byte, responseHeader+len(data))
+			copy(resp[:idSize], frame[:idSize])
+			resp[idSize] = status
+			copy(resp[responseHeader:], data)
+
+			wmu.Lock()
+			defer wmu.Unlock()
+			_ = writeFrame(c, resp)
+		}()
+	}
+}
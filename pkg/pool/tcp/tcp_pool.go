@@ -7,17 +7,34 @@ package tcp
 //
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/pedrogao/plib/pkg/pool/resource"
 )
 
 const (
 	maxQueueLength = 100
+	// probeTimeout 不支持 peek 时，探活读取连接的超时时间
+	probeTimeout = time.Millisecond
+)
+
+var (
+	// ErrPoolClosed is returned by Get after the pool is closed.
+	ErrPoolClosed = resource.ErrClosed
+	// ErrTooManyRequests is returned by Get when too many requests are waiting for a connection.
+	ErrTooManyRequests = resource.ErrTooManyWaiters
+
+	errUnexpectedRead = errors.New("unexpected data on idle connection")
+	errBadFrame       = errors.New("bad frame")
 )
 
 // TcpConfig is a set of configuration for a TCP connection pool
@@ -26,42 +43,174 @@ type TcpConfig struct {
 	Port         int
 	MaxIdleConns int
 	MaxOpenConn  int
+	// MaxLifetime is the maximum amount of time a connection may be reused, 0 means forever.
+	MaxLifetime time.Duration
+	// MaxIdleTime is the maximum amount of time a connection may be idle, 0 means forever.
+	MaxIdleTime time.Duration
+	// CheckOnGet probes an idle connection before handing it out, it costs a
+	// syscall per Get, or a 1ms blocking read where peeking is not supported.
+	CheckOnGet bool
+	// Probe checks whether a connection is alive, defaults to a non-blocking peek
+	// which fails if the peer closed the connection or sent unexpected data.
+	Probe func(conn net.Conn) error
+	// ReapInterval is how often expired idle connections are closed in the background,
+	// defaults to half of the smaller of MaxLifetime and MaxIdleTime.
+	ReapInterval time.Duration
+	// IdleOrder is the order in which idle connections are reused, defaults to LIFO.
+	IdleOrder resource.Order
 }
 
+// TcpConnPool is a pool of TCP connections to a single address
 type TcpConnPool struct {
-	host         string
-	port         int
-	mu           sync.Mutex          // mutex to prevent race conditions
-	idleConns    map[string]*tcpConn // holds the idle connections
-	numOpen      int                 // counter that tracks open connections
-	maxOpenCount int
-	maxIdleCount int
-	// A queue of connection requests
-	requestChan chan *connRequest
+	addr       string
+	nextID     int64                    // id of the next opened connection
+	pool       *resource.Pool[*tcpConn] // the generic pool holding the connections
+	probe      func(conn net.Conn) error
+	checkOnGet bool // idle connections are probed by Get
 }
 
 // CreateTcpConnPool creates a connection pool
-// and starts the worker that handles connection request
+// and starts the reaper that closes expired connections
 func CreateTcpConnPool(cfg *TcpConfig) (*TcpConnPool, error) {
-	pool := &TcpConnPool{
-		host:         cfg.Host,
-		port:         cfg.Port,
-		idleConns:    make(map[string]*tcpConn),
-		requestChan:  make(chan *connRequest, maxQueueLength),
-		maxOpenCount: cfg.MaxOpenConn,
-		maxIdleCount: cfg.MaxIdleConns,
+	p := &TcpConnPool{
+		addr:       net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		probe:      cfg.Probe,
+		checkOnGet: cfg.CheckOnGet,
 	}
+	if p.probe == nil {
+		p.probe = defaultProbe
+	}
+	rc := resource.Config[*tcpConn]{
+		Factory: p.openNewTcpConnection,
+		Destroy: func(c *tcpConn) {
+			_ = c.conn.Close()
+		},
+		MaxOpen:      cfg.MaxOpenConn,
+		MaxIdle:      cfg.MaxIdleConns,
+		MaxWaiting:   maxQueueLength,
+		MaxLifetime:  cfg.MaxLifetime,
+		MaxIdleTime:  cfg.MaxIdleTime,
+		ReapInterval: cfg.ReapInterval,
+		Order:        cfg.IdleOrder,
+	}
+	if cfg.CheckOnGet {
+		rc.Validate = func(c *tcpConn) error {
+			return p.probe(c.conn)
+		}
+	}
+	p.pool = resource.New(rc)
 
-	go pool.handleConnectionRequest()
-
-	return pool, nil
+	return p, nil
 }
 
 // tcpConn is a wrapper for a single tcp connection
 type tcpConn struct {
-	id   string       // A unique id to identify a connection
-	pool *TcpConnPool // The TCP connection pool
-	conn net.Conn     // The underlying TCP connection
+	id   string                       // A unique id to identify a connection
+	pool *TcpConnPool                 // The TCP connection pool
+	conn net.Conn                     // The underlying TCP connection
+	res  *resource.Resource[*tcpConn] // The pooled resource, set when borrowed
+	// reused is set once the connection is returned to the pool,
+	// the peer may have closed it while it was idle
+	reused bool
+}
+
+// Conn is a connection borrowed from the pool, Close returns it to the pool.
+// A connection that had a read or write error is closed instead of being reused.
+type Conn struct {
+	net.Conn
+	tc       *tcpConn
+	mu       sync.Mutex
+	bad      bool  // had a read or write error
+	err      error // the first read or write error
+	received bool  // read some data since it was borrowed
+	discard  bool
+	closed   bool
+	release  func(failed bool) // called on Close, reports whether the peer failed
+}
+
+// Read reads data from the connection
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		c.received = true
+		c.mu.Unlock()
+	}
+	c.markBad(err)
+	return n, err
+}
+
+// Write writes data to the connection
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Write(b)
+	c.markBad(err)
+	return n, err
+}
+
+// Close returns the connection to the pool, it is safe to call Close more than once
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	bad, discard := c.bad, c.discard
+	failed := bad && !c.stale()
+	c.mu.Unlock()
+
+	if c.release != nil {
+		c.release(failed)
+	}
+	if bad || discard || c.Conn.SetDeadline(time.Time{}) != nil {
+		c.tc.pool.closeConn(c.tc)
+		return nil
+	}
+	c.tc.pool.put(c.tc)
+	return nil
+}
+
+// Discard closes the underlying connection instead of returning it to the pool
+func (c *Conn) Discard() error {
+	c.mu.Lock()
+	c.discard = true
+	c.mu.Unlock()
+	return c.Close()
+}
+
+func (c *Conn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *Conn) markBad(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	if !c.bad {
+		c.bad = true
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// stale() reports whether the peer closed the connection while it was idle:
+// a reused connection failing with a closed error before anything is received.
+// It is the normal churn of idle connections rather than a failure of the peer, c.mu must be held
+func (c *Conn) stale() bool {
+	return c.tc.reused && !c.received && closedByPeer(c.err)
+}
+
+func closedByPeer(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
 }
 
 // 4 bytes
@@ -85,21 +234,44 @@ func createTcpBuffer(data []byte) []byte {
 
 // Read() reads the data from the underlying TCP connection
 func (c *tcpConn) Read() ([]byte, error) {
+	return readFrame(c.conn)
+}
+
+// Write() writes the data to the underlying TCP connection
+func (c *tcpConn) Write(data []byte) error {
+	return writeFrame(c.conn, data)
+}
+
+// ReadFrame reads a length-prefixed frame from the connection
+func (c *Conn) ReadFrame() ([]byte, error) {
+	return readFrame(c)
+}
+
+// WriteFrame writes data as a length-prefixed frame to the connection
+func (c *Conn) WriteFrame(data []byte) error {
+	return writeFrame(c, data)
+}
+
+// readFrame() reads a frame written by writeFrame
+func readFrame(r io.Reader) ([]byte, error) {
 	prefix := make([]byte, prefixSize)
 
 	// Read the prefix, which contains the length of data expected
-	_, err := io.ReadFull(c.conn, prefix)
+	_, err := io.ReadFull(r, prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	totalDataLength := binary.BigEndian.Uint32(prefix[:])
+	if totalDataLength < prefixSize {
+		return nil, errBadFrame
+	}
 
 	// Buffer to store the actual data
 	data := make([]byte, totalDataLength-prefixSize)
 
 	// Read actual data without prefix
-	_, err = io.ReadFull(c.conn, data)
+	_, err = io.ReadFull(r, data)
 	if err != nil {
 		return nil, err
 	}
@@ -107,155 +279,103 @@ func (c *tcpConn) Read() ([]byte, error) {
 	return data, nil
 }
 
-// connRequest wraps a channel to receive a connection
-// and a channel to receive an error
-type connRequest struct {
-	connChan chan *tcpConn
-	errChan  chan error
+// writeFrame() writes the data with the prefix created by createTcpBuffer
+func writeFrame(w io.Writer, data []byte) error {
+	_, err := w.Write(createTcpBuffer(data))
+	return err
 }
 
-// put() attempts to return a used connection back to the pool
-// It closes the connection if it can't do so
-func (p *TcpConnPool) put(c *tcpConn) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if p.maxIdleCount > 0 && p.maxIdleCount > len(p.idleConns) {
-		p.idleConns[c.id] = c // put into the pool
-	} else {
-		_ = c.conn.Close()
-		c.pool.numOpen--
+// Get retrieves a connection, waiting until one is available or ctx is done
+func (p *TcpConnPool) Get(ctx context.Context) (*Conn, error) {
+	c, err := p.get(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return &Conn{Conn: c.conn, tc: c}, nil
 }
 
-// get() retrieves a TCP connection
-func (p *TcpConnPool) get() (*tcpConn, error) {
-	p.mu.Lock()
-
-	// Case 1: Gets a free connection from the pool if any
-	numIdle := len(p.idleConns)
-	if numIdle > 0 {
-		// Loop map to get one conn
-		for _, c := range p.idleConns {
-			// remove from pool
-			delete(p.idleConns, c.id)
-			p.mu.Unlock()
-			return c, nil
-		}
-	}
+// Close closes the idle connections, fails the waiting requests and stops the reaper,
+// connections in use are closed when they are returned
+func (p *TcpConnPool) Close() error {
+	return p.pool.Close()
+}
 
-	// Case 2: Queue a connection request
-	if p.maxOpenCount > 0 && p.numOpen >= p.maxOpenCount {
-		// Create the request
-		req := &connRequest{
-			connChan: make(chan *tcpConn, 1),
-			errChan:  make(chan error, 1),
-		}
+// Stats returns the statistics of the pool
+func (p *TcpConnPool) Stats() resource.Stats {
+	return p.pool.Stats()
+}
 
-		// Queue the request
-		p.requestChan <- req
+// get() retrieves a TCP connection
+func (p *TcpConnPool) get(ctx context.Context) (*tcpConn, error) {
+	res, err := p.pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := res.Value()
+	c.res = res
+	return c, nil
+}
 
-		p.mu.Unlock()
+// put() attempts to return a used connection back to the pool
+// It closes the connection if it can't do so
+func (p *TcpConnPool) put(c *tcpConn) {
+	c.reused = true
+	c.res.Release()
+}
 
-		// Waits for either
-		// 1. Request fulfilled, or
-		// 2. An error is returned
-		select {
-		case tcpConn := <-req.connChan:
-			return tcpConn, nil
-		case err := <-req.errChan:
+// verify() makes sure conn reaches the peer: a reused connection which is not probed
+// by Get is probed, and replaced if it is broken, so only a new or probed connection is returned
+func (p *TcpConnPool) verify(ctx context.Context, conn *Conn) (*Conn, error) {
+	for conn.tc.reused && !p.checkOnGet {
+		if err := p.probe(conn.Conn); err == nil {
+			return conn, nil
+		}
+		_ = conn.Discard()
+		var err error
+		if conn, err = p.Get(ctx); err != nil {
 			return nil, err
 		}
 	}
-
-	// Case 3: Open a new connection
-	p.numOpen++
-	p.mu.Unlock()
-
-	newTcpConn, err := p.openNewTcpConnection()
-	if err != nil {
-		p.mu.Lock()
-		p.numOpen--
-		p.mu.Unlock()
-		return nil, err
-	}
-
-	return newTcpConn, nil
+	return conn, nil
 }
 
-// openNewTcpConnection() creates a new TCP connection at p.host and p.port
-func (p *TcpConnPool) openNewTcpConnection() (*tcpConn, error) {
-	addr := fmt.Sprintf("%s:%d", p.host, p.port)
+// closeConn() closes a connection instead of returning it to the pool
+func (p *TcpConnPool) closeConn(c *tcpConn) {
+	c.res.Destroy()
+}
 
-	c, err := net.Dial("tcp", addr)
+// openNewTcpConnection() creates a new TCP connection at p.addr
+func (p *TcpConnPool) openNewTcpConnection(ctx context.Context) (*tcpConn, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", p.addr)
 	if err != nil {
 		return nil, err
 	}
 
 	return &tcpConn{
-		// Use unix time as id
-		id:   fmt.Sprintf("%v", time.Now().UnixNano()),
+		id:   strconv.FormatInt(atomic.AddInt64(&p.nextID, 1), 10),
 		conn: c,
 		pool: p,
 	}, nil
 }
 
-// handleConnectionRequest() listens to the request queue
-// and attempts to fulfil any incoming requests
-func (p *TcpConnPool) handleConnectionRequest() {
-	for req := range p.requestChan {
-		var (
-			requestDone = false
-			hasTimeout  = false
-
-			// start a 3-second timeout
-			timeoutChan = time.After(3 * time.Second)
-		)
-
-		for {
-			if requestDone || hasTimeout {
-				break
-			}
-			select {
-			// request timeout
-			case <-timeoutChan:
-				hasTimeout = true
-				req.errChan <- errors.New("connection request timeout")
-			default:
-				// 1. get idle conn or open new conn
-				// 2. if success, pass conn into req.conn. requestDone!
-				// 3. if fail, we retry until timeout
-				p.mu.Lock()
-
-				// First, we try to get an idle conn.
-				// If failed, we try to open a new conn.
-				// If both does not work, we try again in the next loop until timeout.
-				numIdle := len(p.idleConns)
-				if numIdle > 0 {
-					for _, c := range p.idleConns {
-						delete(p.idleConns, c.id)
-						p.mu.Unlock()
-						req.connChan <- c // give conn
-						requestDone = true
-						break
-					}
-				} else if p.maxOpenCount > 0 && p.numOpen < p.maxOpenCount {
-					p.numOpen++
-					p.mu.Unlock()
-
-					c, err := p.openNewTcpConnection()
-					if err != nil {
-						p.mu.Lock()
-						p.numOpen--
-						p.mu.Unlock()
-					} else {
-						req.connChan <- c // give conn
-						requestDone = true
-					}
-				} else {
-					p.mu.Unlock()
-				}
-			}
-		}
+// readProbe() reads the connection with a short deadline, a healthy idle connection
+// has nothing to read, so EOF, errors or unexpected data mean it is unusable.
+// It blocks up to probeTimeout, so it is only used when peeking is not supported.
+func readProbe(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var buf [1]byte
+	n, err := conn.Read(buf[:])
+	if n > 0 {
+		return errUnexpectedRead
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
 	}
+	return err
 }
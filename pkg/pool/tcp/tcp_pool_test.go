@@ -0,0 +1,255 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts a listener which sends every accepted connection to the returned channel
+func newTestServer(t *testing.T) (*TcpConfig, chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	accepted := make(chan net.Conn, 16)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return &TcpConfig{
+		Host:         addr.IP.String(),
+		Port:         addr.Port,
+		MaxIdleConns: 4,
+		MaxOpenConn:  4,
+	}, accepted
+}
+
+func (p *TcpConnPool) stats() (numOpen, numIdle int) {
+	stats := p.Stats()
+	return stats.Open, stats.Idle
+}
+
+func TestReuse(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	c1, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	pool.put(c1)
+	c2, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, c1, c2)
+}
+
+func TestMaxLifetime(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	cfg.MaxLifetime = 20 * time.Millisecond
+	cfg.ReapInterval = time.Hour
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	c1, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	pool.put(c1)
+	time.Sleep(cfg.MaxLifetime)
+
+	c2, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	assert.NotEqual(t, c1, c2)
+	numOpen, _ := pool.stats()
+	assert.Equal(t, 1, numOpen)
+}
+
+func TestCheckOnGet(t *testing.T) {
+	cfg, accepted := newTestServer(t)
+	cfg.CheckOnGet = true
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	c1, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	pool.put(c1)
+	// still alive
+	c2, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, c1, c2)
+	pool.put(c2)
+
+	// the peer closes the connection
+	server := <-accepted
+	_ = server.Close()
+	time.Sleep(10 * time.Millisecond)
+
+	c3, err := pool.get(context.Background())
+	assert.Nil(t, err)
+	assert.NotEqual(t, c1, c3)
+	numOpen, _ := pool.stats()
+	assert.Equal(t, 1, numOpen)
+}
+
+func TestDefaultProbe(t *testing.T) {
+	cfg, accepted := newTestServer(t)
+	conn, err := net.Dial("tcp", net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port)))
+	assert.Nil(t, err)
+	defer conn.Close()
+	server := <-accepted
+
+	assert.Nil(t, defaultProbe(conn))
+
+	// unexpected data is left in the socket
+	_, err = server.Write([]byte{1})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return defaultProbe(conn) == errUnexpectedRead
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, errUnexpectedRead, defaultProbe(conn))
+
+	// the peer closes the connection
+	conn2, err := net.Dial("tcp", net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port)))
+	assert.Nil(t, err)
+	defer conn2.Close()
+	_ = (<-accepted).Close()
+	assert.Eventually(t, func() bool {
+		return defaultProbe(conn2) != nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestReaper(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	cfg.MaxIdleTime = 20 * time.Millisecond
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	conns := make([]*tcpConn, 3)
+	for i := range conns {
+		conns[i], err = pool.get(context.Background())
+		assert.Nil(t, err)
+	}
+	for _, c := range conns {
+		pool.put(c)
+	}
+	numOpen, numIdle := pool.stats()
+	assert.Equal(t, 3, numOpen)
+	assert.Equal(t, 3, numIdle)
+
+	assert.Eventually(t, func() bool {
+		numOpen, numIdle := pool.stats()
+		return numOpen == 0 && numIdle == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestGetClose(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	c1, err := pool.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, c1.Close())
+	assert.Nil(t, c1.Close())
+	_, err = c1.Write([]byte("ping"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	numOpen, numIdle := pool.stats()
+	assert.Equal(t, 1, numOpen)
+	assert.Equal(t, 1, numIdle)
+
+	c2, err := pool.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, c1.tc, c2.tc)
+	assert.Nil(t, c2.Discard())
+	numOpen, numIdle = pool.stats()
+	assert.Equal(t, 0, numOpen)
+	assert.Equal(t, 0, numIdle)
+}
+
+func TestGetWait(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	cfg.MaxOpenConn = 1
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	c1, err := pool.Get(context.Background())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.Get(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	got := make(chan *Conn)
+	go func() {
+		c, err := pool.Get(context.Background())
+		assert.Nil(t, err)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, c1.Close())
+	c2 := <-got
+	assert.Equal(t, c1.tc, c2.tc)
+
+	// a discarded connection makes room for a new one
+	go func() {
+		c, err := pool.Get(context.Background())
+		assert.Nil(t, err)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, c2.Discard())
+	c3 := <-got
+	assert.NotEqual(t, c2.tc, c3.tc)
+	assert.Nil(t, c3.Close())
+
+	numOpen, numIdle := pool.stats()
+	assert.Equal(t, 1, numOpen)
+	assert.Equal(t, 1, numIdle)
+}
+
+func TestPoolClose(t *testing.T) {
+	cfg, _ := newTestServer(t)
+	cfg.MaxOpenConn = 1
+	cfg.MaxIdleTime = time.Minute
+	pool, err := CreateTcpConnPool(cfg)
+	assert.Nil(t, err)
+
+	c1, err := pool.Get(context.Background())
+	assert.Nil(t, err)
+	waitErr := make(chan error)
+	go func() {
+		_, err := pool.Get(context.Background())
+		waitErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Nil(t, pool.Close())
+	assert.Nil(t, pool.Close())
+	assert.Equal(t, ErrPoolClosed, <-waitErr)
+	_, err = pool.Get(context.Background())
+	assert.Equal(t, ErrPoolClosed, err)
+
+	// connections in use are closed when returned
+	assert.Nil(t, c1.Close())
+	numOpen, numIdle := pool.stats()
+	assert.Equal(t, 0, numOpen)
+	assert.Equal(t, 0, numIdle)
+	_, err = c1.tc.conn.Write([]byte("ping"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
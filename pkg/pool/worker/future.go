@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+)
+
+type (
+	// ResultTask 有返回值的任务，ctx 在任务自身的 ctx 撤销或者 pool 被 Stop 时撤销
+	ResultTask[T any] interface {
+		// Do 执行任务
+		Do(ctx context.Context) (T, error)
+
+		// Context 返回上下文
+		Context() context.Context
+	}
+
+	// Future 异步任务的执行结果
+	Future[T any] struct {
+		done  chan struct{}
+		value T
+		err   error
+	}
+
+	// futureTask 将 ResultTask 包装为 ContextTask，执行完毕后写入 future
+	futureTask[T any] struct {
+		task   ResultTask[T]
+		future *Future[T]
+	}
+
+	// funcTask 函数任务
+	funcTask[T any] struct {
+		fn  func(ctx context.Context) (T, error)
+		ctx context.Context
+	}
+)
+
+// NewResultTask 使用函数新建有返回值的任务
+func NewResultTask[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) ResultTask[T] {
+	return &funcTask[T]{fn: fn, ctx: ctx}
+}
+
+// SubmitFuture 提交任务，通过 Future 获取任务的返回值和错误。
+// ctx 已撤销的任务不会被执行，pool 已停止或者 Stop 时任务仍在等待队列中，
+// 那么返回 ErrStopped，任务因队列已满被丢弃时返回 ErrRejected
+func SubmitFuture[T any](p *WorkerPool, task ResultTask[T]) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	t := &futureTask[T]{task: task, future: f}
+
+	_ = p.submit(t, 0, false)
+	return f
+}
+
+// Get 阻塞直到任务完成，返回任务的返回值和错误
+func (f *Future[T]) Get() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Wait 阻塞直到任务完成或者 ctx 撤销
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done 任务完成后被关闭
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Do 执行任务
+func (t *futureTask[T]) Do() error {
+	return t.DoContext(t.Context())
+}
+
+// DoContext 执行任务，并保存返回值
+func (t *futureTask[T]) DoContext(ctx context.Context) error {
+	value, err := t.task.Do(ctx)
+	t.future.value = value
+	return err
+}
+
+// Context 返回上下文
+func (t *futureTask[T]) Context() context.Context {
+	return t.task.Context()
+}
+
+func (t *futureTask[T]) complete(err error) {
+	t.future.err = err
+	close(t.future.done)
+}
+
+// Do 执行任务
+func (t *funcTask[T]) Do(ctx context.Context) (T, error) {
+	return t.fn(ctx)
+}
+
+// Context 返回上下文
+func (t *funcTask[T]) Context() context.Context {
+	return t.ctx
+}
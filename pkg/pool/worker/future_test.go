@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestSubmitFuture(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(2)
+	defer wp.Stop()
+
+	futures := make([]*Future[int], 10)
+	for i := range futures {
+		i := i
+		futures[i] = SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+			return i * i, nil
+		}))
+	}
+	for i, f := range futures {
+		v, err := f.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i*i, v)
+	}
+
+	errFail := errors.New("fail")
+	_, err := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 0, errFail
+	})).Get()
+	assert.Equal(t, errFail, err)
+}
+
+func TestFuturePanic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	defer wp.Stop()
+
+	_, err := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		panic("boom")
+	})).Get()
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+
+	// panic 不会杀死 worker
+	wp.Submit(&fakeTask{fn: func() { panic("boom") }, ctx: context.Background()})
+	v, err := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 1, nil
+	})).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestSkipCancelledTask(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	defer wp.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	_, err := SubmitFuture(wp, NewResultTask(ctx, func(ctx context.Context) (int, error) {
+		ran = true
+		return 1, nil
+	})).Get()
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, ran)
+}
+
+func TestStopCancelsTasks(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	started := make(chan struct{})
+	running := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}))
+	<-started
+	queued := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 1, nil
+	}))
+
+	wp.Stop()
+	_, err := running.Get()
+	assert.Equal(t, context.Canceled, err)
+	_, err = queued.Get()
+	assert.Equal(t, ErrStopped, err)
+
+	_, err = SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 1, nil
+	})).Get()
+	assert.Equal(t, ErrStopped, err)
+}
+
+func TestFutureWait(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	release := make(chan struct{})
+	f := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.Wait(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	close(release)
+	v, err := f.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	wp.StopWait()
+}
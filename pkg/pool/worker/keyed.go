@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+// KeyedPool 按 key 将任务哈希到固定的 lane，每个 lane 只有一个 worker，
+// 相同 key 的任务按提交顺序依次执行，不同 key 的任务并行执行。
+// 注意：RejectDropOldest、RejectCallerRuns 策略会打破相同 key 的执行顺序
+type KeyedPool struct {
+	lanes []*WorkerPool
+}
+
+// NewKeyed an instance of keyed pool with the given number of lanes,
+// the options apply to every lane.
+func NewKeyed(lanes int, opts ...Option) *KeyedPool {
+	if lanes < 1 {
+		lanes = 1
+	}
+	pool := &KeyedPool{
+		lanes: make([]*WorkerPool, lanes),
+	}
+	for i := range pool.lanes {
+		pool.lanes[i] = New(1, opts...)
+	}
+	return pool
+}
+
+// SubmitKeyedFuture 提交任务到 key 对应的 lane，通过 Future 获取任务的返回值和错误
+func SubmitKeyedFuture[T any](k *KeyedPool, key string, task ResultTask[T]) *Future[T] {
+	return SubmitFuture(k.lane(key), task)
+}
+
+// Size lane 个数
+func (k *KeyedPool) Size() int {
+	return len(k.lanes)
+}
+
+// Submit 提交任务到 key 对应的 lane
+func (k *KeyedPool) Submit(key string, task Task) {
+	k.lane(key).Submit(task)
+}
+
+// TrySubmit 提交任务到 key 对应的 lane，任务被拒绝时返回错误
+func (k *KeyedPool) TrySubmit(key string, task Task) error {
+	return k.lane(key).TrySubmit(task)
+}
+
+// SubmitWait 提交任务到 key 对应的 lane，并等待任务完成
+func (k *KeyedPool) SubmitWait(key string, task Task) {
+	k.lane(key).SubmitWait(task)
+}
+
+// Stop 停止且无等待
+func (k *KeyedPool) Stop() {
+	for _, lane := range k.lanes {
+		lane.Stop()
+	}
+}
+
+// StopWait 停止且等待任务完成
+func (k *KeyedPool) StopWait() {
+	for _, lane := range k.lanes {
+		lane.StopWait()
+	}
+}
+
+// Stopped 是否已停止
+func (k *KeyedPool) Stopped() bool {
+	return k.lanes[0].Stopped()
+}
+
+// Pause 暂停所有 lane，直到 ctx 撤销、或者 stop
+func (k *KeyedPool) Pause(ctx context.Context) {
+	for _, lane := range k.lanes {
+		lane.Pause(ctx)
+	}
+}
+
+// WaitingQueueSize 所有 lane 等待队列任务个数
+func (k *KeyedPool) WaitingQueueSize() int {
+	size := 0
+	for _, lane := range k.lanes {
+		size += lane.WaitingQueueSize()
+	}
+	return size
+}
+
+// lane 返回 key 对应的 lane
+func (k *KeyedPool) lane(key string) *WorkerPool {
+	return k.lanes[hash.Murmur332([]byte(key), hash.DefaultSeed)%uint32(len(k.lanes))]
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestKeyedOrder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	kp := NewKeyed(4)
+	var (
+		lock   sync.Mutex
+		orders = map[string][]int{}
+	)
+	for i := 0; i < 100; i++ {
+		for k := 0; k < 8; k++ {
+			i, key := i, fmt.Sprintf("user-%d", k)
+			kp.Submit(key, &fakeTask{fn: func() {
+				lock.Lock()
+				defer lock.Unlock()
+				orders[key] = append(orders[key], i)
+			}, ctx: context.Background()})
+		}
+	}
+	kp.StopWait()
+
+	assert.True(t, kp.Stopped())
+	assert.Equal(t, 8, len(orders))
+	for key, order := range orders {
+		assert.Equal(t, 100, len(order), key)
+		for i, v := range order {
+			assert.Equal(t, i, v, key)
+		}
+	}
+}
+
+func TestKeyedParallel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	kp := NewKeyed(8)
+	defer kp.Stop()
+
+	// 找到落在不同 lane 上的两个 key
+	keys := []string{"a"}
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprint(i)
+		if kp.lane(key) != kp.lane(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	release := make(chan struct{})
+	kp.Submit(keys[0], &fakeTask{fn: func() { <-release }, ctx: context.Background()})
+	v, err := SubmitKeyedFuture(kp, keys[1], NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 1, nil
+	})).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	close(release)
+}
+
+func TestKeyedPause(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	kp := NewKeyed(4)
+	ctx, cancel := context.WithCancel(context.Background())
+	kp.Pause(ctx)
+
+	var ran int32
+	for k := 0; k < 8; k++ {
+		kp.Submit(fmt.Sprint(k), &fakeTask{fn: func() {
+			atomic.AddInt32(&ran, 1)
+		}, ctx: context.Background()})
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+	assert.Equal(t, 8, kp.WaitingQueueSize())
+
+	cancel()
+	kp.StopWait()
+	assert.Equal(t, int32(8), atomic.LoadInt32(&ran))
+}
+
+func TestKeyedStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	kp := NewKeyed(2)
+	started := make(chan struct{})
+	running := SubmitKeyedFuture(kp, "a", NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}))
+	<-started
+	queued := SubmitKeyedFuture(kp, "a", NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return 1, nil
+	}))
+
+	kp.Stop()
+	_, err := running.Get()
+	assert.Equal(t, context.Canceled, err)
+	_, err = queued.Get()
+	assert.Equal(t, ErrStopped, err)
+	assert.Equal(t, ErrStopped, kp.TrySubmit("a", &fakeTask{fn: func() {}, ctx: context.Background()}))
+}
@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// newFullPool 新建一个 worker 被阻塞、队列已满的 pool，关闭 release 后 worker 继续执行
+func newFullPool(policy RejectPolicy) (*WorkerPool, chan struct{}, []*Future[int]) {
+	wp := New(1, WithMaxQueueSize(2), WithRejectPolicy(policy))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wp.Submit(&fakeTask{fn: func() {
+		close(started)
+		<-release
+	}, ctx: context.Background()})
+	<-started
+
+	futures := make([]*Future[int], 2)
+	for i := range futures {
+		futures[i] = submitValue(wp, i)
+	}
+	return wp, release, futures
+}
+
+func submitValue(wp *WorkerPool, v int) *Future[int] {
+	return SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+		return v, nil
+	}))
+}
+
+func TestRejectBlock(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, futures := newFullPool(RejectBlock)
+	assert.Equal(t, ErrRejected, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+
+	submitted := make(chan *Future[int])
+	go func() {
+		submitted <- submitValue(wp, 2)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("submit should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	futures = append(futures, <-submitted)
+	for i, f := range futures {
+		v, err := f.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i, v)
+	}
+	wp.StopWait()
+}
+
+func TestRejectBlockStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, _ := newFullPool(RejectBlock)
+	submitted := make(chan *Future[int])
+	go func() {
+		submitted <- submitValue(wp, 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wp.Stop()
+	f := <-submitted
+	<-f.Done()
+}
+
+func TestRejectDropNewest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, futures := newFullPool(RejectDropNewest)
+	assert.Equal(t, ErrRejected, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+	_, err := submitValue(wp, 2).Get()
+	assert.Equal(t, ErrRejected, err)
+
+	close(release)
+	for i, f := range futures {
+		v, err := f.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i, v)
+	}
+	wp.StopWait()
+}
+
+func TestRejectDropOldest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, futures := newFullPool(RejectDropOldest)
+	futures = append(futures, submitValue(wp, 2))
+	_, err := futures[0].Get()
+	assert.Equal(t, ErrRejected, err)
+
+	close(release)
+	for i, f := range futures[1:] {
+		v, err := f.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i+1, v)
+	}
+	assert.Nil(t, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+	wp.StopWait()
+}
+
+func TestRejectCallerRuns(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, futures := newFullPool(RejectCallerRuns)
+	ran := false
+	assert.Nil(t, wp.TrySubmit(&fakeTask{fn: func() { ran = true }, ctx: context.Background()}))
+	assert.True(t, ran)
+
+	close(release)
+	for _, f := range futures {
+		_, err := f.Get()
+		assert.Nil(t, err)
+	}
+	wp.StopWait()
+}
+
+func TestRejectError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp, release, _ := newFullPool(RejectError)
+	assert.Equal(t, ErrRejected, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+	close(release)
+	wp.StopWait()
+	assert.Equal(t, ErrStopped, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"sync/atomic"
+
+	"github.com/pedrogao/plib/pkg/internal/metrics"
+)
+
+type (
+	// Stats is the snapshot of the worker pool statistics.
+	Stats struct {
+		// Submitted is the number of tasks accepted by the pool.
+		Submitted int64 `json:"submitted"`
+		// Completed is the number of tasks finished without error.
+		Completed int64 `json:"completed"`
+		// Failed is the number of tasks finished with an error, skipped or dropped by Stop.
+		Failed int64 `json:"failed"`
+		// Rejected is the number of tasks rejected by a full queue or a stopped pool.
+		Rejected int64 `json:"rejected"`
+		// Workers is the number of live workers.
+		Workers int `json:"workers"`
+		// Running is the number of workers executing a task.
+		Running int `json:"running"`
+		// Waiting is the number of tasks in the waiting queue.
+		Waiting int `json:"waiting"`
+		// Latency is the histogram of the execution time of tasks.
+		Latency HistogramStats `json:"latency"`
+		// QueueWait is the histogram of the time from submission to execution.
+		QueueWait HistogramStats `json:"queueWait"`
+	}
+
+	// HistogramStats is the snapshot of a latency histogram.
+	HistogramStats = metrics.HistogramStats
+
+	// Bucket is a bucket of the histogram, Le of the last bucket is 0 which means +Inf.
+	Bucket = metrics.Bucket
+
+	poolMetrics struct {
+		submitted int64
+		completed int64
+		failed    int64
+		rejected  int64
+		workers   int64
+		running   int64
+		latency   metrics.Histogram
+		queueWait metrics.Histogram
+	}
+)
+
+// Stats 返回 pool 的统计信息
+func (p *WorkerPool) Stats() Stats {
+	m := &p.metrics
+	return Stats{
+		Submitted: atomic.LoadInt64(&m.submitted),
+		Completed: atomic.LoadInt64(&m.completed),
+		Failed:    atomic.LoadInt64(&m.failed),
+		Rejected:  atomic.LoadInt64(&m.rejected),
+		Workers:   int(atomic.LoadInt64(&m.workers)),
+		Running:   int(atomic.LoadInt64(&m.running)),
+		Waiting:   p.WaitingQueueSize(),
+		Latency:   m.latency.Stats(),
+		QueueWait: m.queueWait.Stats(),
+	}
+}
+
+// finish 记录任务结果
+func (m *poolMetrics) finish(err error) {
+	if err != nil {
+		atomic.AddInt64(&m.failed, 1)
+	} else {
+		atomic.AddInt64(&m.completed, 1)
+	}
+}
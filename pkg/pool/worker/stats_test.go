@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type ctxKey struct{}
+
+func TestStats(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(2, WithMaxQueueSize(4), WithRejectPolicy(RejectDropNewest))
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		wp.Submit(&fakeTask{fn: func() {
+			started <- struct{}{}
+			<-release
+		}, ctx: context.Background()})
+	}
+	<-started
+	<-started
+	stats := wp.Stats()
+	assert.Equal(t, 2, stats.Workers)
+	assert.Equal(t, 2, stats.Running)
+
+	futures := make([]*Future[int], 0, 4)
+	for i := 0; i < 4; i++ {
+		i := i
+		futures = append(futures, SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (int, error) {
+			if i%2 == 0 {
+				return 0, errors.New("fail")
+			}
+			return i, nil
+		})))
+	}
+	assert.Equal(t, ErrRejected, wp.TrySubmit(&fakeTask{fn: func() {}, ctx: context.Background()}))
+
+	time.Sleep(5 * time.Millisecond)
+	close(release)
+	for _, f := range futures {
+		<-f.Done()
+	}
+	wp.StopWait()
+
+	stats = wp.Stats()
+	assert.Equal(t, int64(6), stats.Submitted)
+	assert.Equal(t, int64(4), stats.Completed)
+	assert.Equal(t, int64(2), stats.Failed)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, 0, stats.Workers)
+	assert.Equal(t, 0, stats.Running)
+	assert.Equal(t, 0, stats.Waiting)
+	assert.Equal(t, int64(6), stats.Latency.Count)
+	assert.Equal(t, int64(6), stats.QueueWait.Count)
+	assert.True(t, stats.Latency.Max >= 5*time.Millisecond)
+	assert.True(t, stats.QueueWait.Max >= 5*time.Millisecond)
+}
+
+func TestHooks(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var (
+		lock    sync.Mutex
+		events  []string
+		panics  []any
+		results []error
+	)
+	record := func(event string) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, event)
+	}
+	wp := New(1,
+		WithBeforeTask(func(ctx context.Context, task Task) context.Context {
+			record("before")
+			return context.WithValue(ctx, ctxKey{}, "span")
+		}),
+		WithAfterTask(func(ctx context.Context, task Task, err error, latency time.Duration) {
+			record("after:" + ctx.Value(ctxKey{}).(string))
+			lock.Lock()
+			results = append(results, err)
+			lock.Unlock()
+		}),
+		WithOnPanic(func(task Task, value any, stack []byte) {
+			record("panic")
+			lock.Lock()
+			panics = append(panics, value)
+			lock.Unlock()
+		}),
+	)
+
+	v, err := SubmitFuture(wp, NewResultTask(context.Background(), func(ctx context.Context) (string, error) {
+		record("do")
+		return ctx.Value(ctxKey{}).(string), nil
+	})).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "span", v)
+
+	wp.SubmitWait(&fakeTask{fn: func() { panic("boom") }, ctx: context.Background()})
+	wp.StopWait()
+
+	assert.Equal(t, []string{"before", "do", "after:span", "before", "panic", "after:span"}, events)
+	assert.Equal(t, []any{"boom"}, panics)
+	assert.Nil(t, results[0])
+	var panicErr *PanicError
+	assert.True(t, errors.As(results[1], &panicErr))
+}
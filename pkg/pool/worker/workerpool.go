@@ -1,12 +1,15 @@
 package worker
 
 import (
+	"container/heap"
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/gammazero/deque"
 	"github.com/pedrogao/plib/pkg/log"
 )
 
@@ -17,9 +20,32 @@ reference:
 */
 
 const (
-	// 休眠时间，如果 worker 长时间不工作，那么停掉 worker
+	// 默认休眠时间，如果 worker 长时间不工作，那么停掉 worker
 	// If workers idle for at least this period of time, then stop a worker.
-	idleTimeout = 2 * time.Second
+	defaultIdleTimeout = 2 * time.Second
+)
+
+// RejectPolicy 等待队列已满时的拒绝策略
+type RejectPolicy int
+
+const (
+	// RejectBlock 阻塞提交者直到队列有空位
+	RejectBlock RejectPolicy = iota
+	// RejectDropNewest 丢弃新提交的任务
+	RejectDropNewest
+	// RejectDropOldest 丢弃等待队列中最早提交的任务
+	RejectDropOldest
+	// RejectCallerRuns 在提交者的 goroutine 中直接执行任务
+	RejectCallerRuns
+	// RejectError 拒绝新提交的任务并记录错误日志
+	RejectError
+)
+
+var (
+	// ErrStopped is returned when a task is submitted to, or dropped by, a stopped pool.
+	ErrStopped = errors.New("worker pool stopped")
+	// ErrRejected is returned when a task is rejected because the queue is full.
+	ErrRejected = errors.New("worker pool queue is full")
 )
 
 type (
@@ -32,13 +58,122 @@ type (
 		Context() context.Context
 	}
 
+	// ContextTask 可感知撤销的任务，实现了该接口的任务执行 DoContext 而不是 Do，
+	// ctx 在任务自身的 ctx 撤销或者 pool 被 Stop 时撤销
+	ContextTask interface {
+		Task
+
+		// DoContext 执行任务
+		DoContext(ctx context.Context) error
+	}
+
+	// PanicError is returned when a task panics.
+	PanicError struct {
+		Value any
+		Stack []byte
+	}
+
+	// completer 需要得知任务执行结果的任务，例如 future
+	completer interface {
+		complete(err error)
+	}
+
 	// defaultTask 默认任务
 	defaultTask struct {
 		fn  func()
 		ctx context.Context
 	}
+
+	// prioritizedTask 带优先级的任务，优先级相同时按提交顺序执行
+	prioritizedTask struct {
+		Task
+		priority  int
+		seq       uint64
+		slot      bool      // 是否占用了队列的空位
+		evict     bool      // 队列已满，入队时丢弃最早的任务
+		internal  bool      // 暂停等内部任务，不计入统计，也不调用钩子
+		submitted time.Time // 提交时间，用于统计排队时间
+	}
+
+	// waitTask SubmitWait 提交的任务，完成或者被丢弃后通知 done
+	waitTask struct {
+		Task
+		done chan struct{}
+	}
+
+	// taskHeap 等待队列，优先级高的在堆顶
+	taskHeap []*prioritizedTask
+
+	options struct {
+		idleTimeout  time.Duration
+		maxQueueSize int
+		rejectPolicy RejectPolicy
+		hooks        hooks
+	}
+
+	// hooks 任务生命周期钩子，task 为提交的任务
+	hooks struct {
+		beforeTask func(ctx context.Context, task Task) context.Context
+		afterTask  func(ctx context.Context, task Task, err error, latency time.Duration)
+		onPanic    func(task Task, value any, stack []byte)
+	}
+
+	// Option defines the method to customize the worker pool.
+	Option func(opts *options)
 )
 
+// WithIdleTimeout customizes how long a worker may be idle before it is stopped.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		if timeout > 0 {
+			opts.idleTimeout = timeout
+		}
+	}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v\n%s", e.Value, e.Stack)
+}
+
+// WithMaxQueueSize limits the number of tasks that are submitted but not yet
+// handed to a worker, 0 means unlimited.
+func WithMaxQueueSize(size int) Option {
+	return func(opts *options) {
+		if size > 0 {
+			opts.maxQueueSize = size
+		}
+	}
+}
+
+// WithRejectPolicy customizes what happens when the queue is full, defaults to RejectBlock.
+func WithRejectPolicy(policy RejectPolicy) Option {
+	return func(opts *options) {
+		opts.rejectPolicy = policy
+	}
+}
+
+// WithBeforeTask sets a hook called before a task is executed, the returned context
+// is passed to ContextTask, e.g. a context carrying a tracing span.
+func WithBeforeTask(fn func(ctx context.Context, task Task) context.Context) Option {
+	return func(opts *options) {
+		opts.hooks.beforeTask = fn
+	}
+}
+
+// WithAfterTask sets a hook called after a task is executed.
+func WithAfterTask(fn func(ctx context.Context, task Task, err error, latency time.Duration)) Option {
+	return func(opts *options) {
+		opts.hooks.afterTask = fn
+	}
+}
+
+// WithOnPanic sets a hook called when a task panics.
+func WithOnPanic(fn func(task Task, value any, stack []byte)) Option {
+	return func(opts *options) {
+		opts.hooks.onPanic = fn
+	}
+}
+
 // Do 执行任务
 func (d *defaultTask) Do() error {
 	d.fn()
@@ -51,17 +186,33 @@ func (d *defaultTask) Context() context.Context {
 }
 
 // New an instance of worker pool
-func New(maxWorkers int) *WorkerPool {
+func New(maxWorkers int, opts ...Option) *WorkerPool {
 	if maxWorkers < 1 {
 		maxWorkers = 1
 	}
+	ops := options{
+		idleTimeout: defaultIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(&ops)
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	pool := &WorkerPool{
-		maxWorkers:  maxWorkers,
-		taskQueue:   make(chan Task, 1),
-		workerQueue: make(chan Task),
-		stopSignal:  make(chan struct{}),
-		stoppedChan: make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		maxWorkers:   int32(maxWorkers),
+		idleTimeout:  ops.idleTimeout,
+		taskQueue:    make(chan *prioritizedTask, 1),
+		workerQueue:  make(chan Task),
+		stopSignal:   make(chan struct{}),
+		stoppedChan:  make(chan struct{}),
+		resizeSignal: make(chan struct{}, 1),
+		rejectPolicy: ops.rejectPolicy,
+		hooks:        ops.hooks,
+	}
+	if ops.maxQueueSize > 0 {
+		pool.slots = make(chan struct{}, ops.maxQueueSize)
 	}
 
 	go pool.dispatch()
@@ -75,12 +226,22 @@ func New(maxWorkers int) *WorkerPool {
 // | taskQueue | --> | waitingQueue | --> | workerQueue |
 // +-----------+     +--------------+     +-------------+
 type WorkerPool struct {
-	maxWorkers   int           // 最大 worker 个数
-	taskQueue    chan Task     // 任务队列
-	workerQueue  chan Task     // 工作队列
-	stoppedChan  chan struct{} // 已停止状态
-	stopSignal   chan struct{} // 停止动作
-	waitingQueue deque.Deque   // 等待队列
+	ctx          context.Context // Stop 时撤销，通知执行中的 ContextTask
+	cancel       context.CancelFunc
+	maxWorkers   int32                 // 最大 worker 个数，可以通过 Resize 修改
+	idleTimeout  time.Duration         // worker 空闲超时时间
+	taskQueue    chan *prioritizedTask // 任务队列
+	workerQueue  chan Task             // 工作队列
+	stoppedChan  chan struct{}         // 已停止状态
+	stopSignal   chan struct{}         // 停止动作
+	resizeSignal chan struct{}         // 通知 dispatch 调整 worker 个数
+	waitingQueue taskHeap              // 等待队列
+	slots        chan struct{}         // 队列空位，为 nil 时不限制队列长度
+	rejectPolicy RejectPolicy          // 队列已满时的拒绝策略
+	submitLock   sync.RWMutex          // 提交任务时持有读锁，保证 taskQueue 关闭时没有提交者
+	hooks        hooks                 // 任务生命周期钩子
+	metrics      poolMetrics           // 统计信息
+	seq          uint64                // 进入等待队列的序号，只在 dispatch 中使用
 	stopLock     sync.Mutex
 	stopOnce     sync.Once
 	stopped      bool  // 是否停止
@@ -90,7 +251,26 @@ type WorkerPool struct {
 
 // Size worker 个数
 func (p *WorkerPool) Size() int {
-	return p.maxWorkers
+	return int(atomic.LoadInt32(&p.maxWorkers))
+}
+
+// Resize 调整最大 worker 个数，多余的 worker 空闲后被停止，
+// 暂停期间扩容新建的 worker 不会被暂停
+func (p *WorkerPool) Resize(maxWorkers int) {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	p.stopLock.Lock()
+	defer p.stopLock.Unlock()
+	if p.stopped {
+		return
+	}
+
+	atomic.StoreInt32(&p.maxWorkers, int32(maxWorkers))
+	select {
+	case p.resizeSignal <- struct{}{}:
+	default:
+	}
 }
 
 // Stop 停止且无等待
@@ -111,12 +291,21 @@ func (p *WorkerPool) Stopped() bool {
 	return p.stopped
 }
 
-// Submit 提交任务无阻塞
+// Submit 提交任务，队列未满时无阻塞，队列已满时按拒绝策略处理
 func (p *WorkerPool) Submit(task Task) {
-	if task == nil {
-		return
-	}
-	p.taskQueue <- task // 无需等待
+	p.SubmitWithPriority(task, 0)
+}
+
+// SubmitWithPriority 提交带优先级的任务，等待队列中优先级高的任务先执行，
+// 优先级相同时按提交顺序执行
+func (p *WorkerPool) SubmitWithPriority(task Task, priority int) {
+	_ = p.submit(task, priority, false)
+}
+
+// TrySubmit 提交任务，任务因队列已满被拒绝时返回 ErrRejected，pool 已停止时返回 ErrStopped。
+// 与 Submit 不同，RejectBlock 策略下队列已满时不阻塞，而是直接拒绝
+func (p *WorkerPool) TrySubmit(task Task) error {
+	return p.submit(task, 0, true)
 }
 
 // SubmitWait 提交任务且已阻塞
@@ -124,20 +313,12 @@ func (p *WorkerPool) SubmitWait(task Task) {
 	if task == nil {
 		return
 	}
-	// 通过 channel 来阻塞等待任务完成
-	doneChan := make(chan struct{})
-	t := &defaultTask{
-		fn: func() {
-			err := task.Do()
-			if err != nil {
-				log.Error("do task err: ", err)
-			}
-			close(doneChan) // 任务执行完毕后通知 doneChan，然后函数返回
-		},
-		ctx: task.Context(),
+	// 通过 channel 来阻塞等待任务完成或者被丢弃
+	t := &waitTask{Task: task, done: make(chan struct{})}
+	if p.submit(t, 0, false) != nil {
+		return
 	}
-	p.taskQueue <- t
-	<-doneChan // 阻塞，等待被关闭
+	<-t.done // 阻塞，等待被关闭
 }
 
 // Pause 暂停所有 worker
@@ -150,9 +331,10 @@ func (p *WorkerPool) Pause(ctx context.Context) {
 		return
 	}
 
+	maxWorkers := p.Size()
 	ready := new(sync.WaitGroup)
-	ready.Add(p.maxWorkers)
-	for i := 0; i < p.maxWorkers; i++ {
+	ready.Add(maxWorkers)
+	for i := 0; i < maxWorkers; i++ {
 		t := &defaultTask{
 			fn: func() {
 				ready.Done()
@@ -164,7 +346,8 @@ func (p *WorkerPool) Pause(ctx context.Context) {
 			},
 			ctx: ctx,
 		}
-		p.Submit(t)
+		// 暂停任务不受队列长度限制，持有 stopLock 时 taskQueue 不会被关闭
+		p.taskQueue <- &prioritizedTask{Task: t, internal: true}
 	}
 	ready.Wait() // wait for all
 }
@@ -176,7 +359,7 @@ func (p *WorkerPool) WaitingQueueSize() int {
 
 func (p *WorkerPool) dispatch() {
 	defer close(p.stoppedChan) // 关闭 stopped channel，通知 stop 函数退出
-	timeout := time.NewTimer(idleTimeout)
+	timeout := time.NewTimer(p.idleTimeout)
 	var (
 		workerCount int
 		idle        bool
@@ -185,11 +368,27 @@ func (p *WorkerPool) dispatch() {
 
 Loop:
 	for {
+		maxWorkers := p.Size()
+		// 扩容之后，直接为等待队列中的任务新建 worker
+		for p.waitingQueue.Len() != 0 && workerCount < maxWorkers {
+			wg.Add(1)
+			go p.startWorker(p.dequeue(), &wg)
+			workerCount++
+		}
+		// 缩容之后，向空闲的 worker 发送 nil，杀死多余的 worker
+		var killQueue chan Task
+		if workerCount > maxWorkers {
+			killQueue = p.workerQueue
+		}
 		// 如果等待队列有任务，那么先将等待队列中的任务转交给工作队列中
 		if p.waitingQueue.Len() != 0 {
-			if !p.processWaitingQueue() {
+			ok, killed := p.processWaitingQueue(killQueue)
+			if !ok {
 				break Loop // 如果 taskQueue 被关闭了，那么直接退出loop
 			}
+			if killed {
+				workerCount--
+			}
 			// 每次任务转移，那么 continue，继续下次
 			// 这里相当于 while 循环，直到将 waitingQueue 中的任务清零
 			continue
@@ -201,23 +400,33 @@ Loop:
 			if !ok {
 				break Loop // 任务队列已关闭，那么直接 break
 			}
+			if workerCount > maxWorkers {
+				// worker 超过了最大数，等待多余的 worker 被杀死
+				p.enqueue(task)
+				idle = false
+				continue
+			}
 			// 将任务提交至 workerQueue
 			select {
 			case p.workerQueue <- task: // 提交至工作队列
+				p.release(task)
 			default:
 				// 如果 workerQueue 提交不了，那么尝试新建 worker
 				// 或者将任务提交至 waitingQueue
-				if workerCount < p.maxWorkers {
+				if workerCount < maxWorkers {
+					p.release(task)
 					wg.Add(1)
-					go startWorker(task, p.workerQueue, &wg)
+					go p.startWorker(task, &wg)
 					workerCount++
 				} else {
 					// 如果 worker 已经达到了最大数，那么将任务交给等待队列
-					p.waitingQueue.PushBack(task)
-					atomic.StoreInt32(&p.waiting, int32(p.waitingQueue.Len()))
+					p.enqueue(task)
 				}
 			}
 			idle = false // 无空闲 worker
+		case killQueue <- nil:
+			workerCount--
+		case <-p.resizeSignal:
 		case <-timeout.C:
 			// taskQueue 中长时间无任务，那么尝试杀死多余的 worker，避免浪费
 			if idle && workerCount > 0 {
@@ -226,13 +435,17 @@ Loop:
 					workerCount--
 				}
 			}
-			idle = true                // 有空闲 worker
-			timeout.Reset(idleTimeout) // 重置定时器
+			idle = true                  // 有空闲 worker
+			timeout.Reset(p.idleTimeout) // 重置定时器
 		}
 	}
 	// 等待处理 waitingQueue 中的任务
 	if p.wait {
 		p.runQueuedTasks()
+	} else {
+		// 不再转交任务后才撤销执行中的任务，避免 worker 提前取走等待队列中的任务
+		p.cancel()
+		p.rejectQueuedTasks()
 	}
 	// 向任务队列中发送 nil 任务，worker 收到 nil 后会将自己杀死
 	for workerCount > 0 {
@@ -244,30 +457,129 @@ Loop:
 	}
 	wg.Wait() // 等待 worker 死亡，避免 goroutine 泄漏
 	timeout.Stop()
+	p.cancel()
 }
 
 // startWorker 开启 worker
-func startWorker(task Task, workerQueue chan Task, wg *sync.WaitGroup) {
-	err := task.Do() // 1. 先执行提交任务
-	if err != nil {
-		log.Error("do task err: ", err)
-	}
-	// TODO go safety
-	go worker(workerQueue, wg) // 2. 然后开启循环，监听 workerQueue
+func (p *WorkerPool) startWorker(task Task, wg *sync.WaitGroup) {
+	atomic.AddInt64(&p.metrics.workers, 1)
+	p.runTask(task) // 1. 先执行提交任务
+	go p.worker(wg) // 2. 然后开启循环，监听 workerQueue
 }
 
-func worker(workerQueue chan Task, wg *sync.WaitGroup) {
-	for task := range workerQueue {
+func (p *WorkerPool) worker(wg *sync.WaitGroup) {
+	for task := range p.workerQueue {
 		// 收到 nil，退出函数，即将自己杀死
 		if task == nil {
+			atomic.AddInt64(&p.metrics.workers, -1)
 			wg.Done() // -1
 			return
 		}
-		err := task.Do() // 否则，执行任务
-		if err != nil {
-			log.Error("do task err: ", err)
+		p.runTask(task) // 否则，执行任务
+	}
+}
+
+// runTask 执行任务，ctx 已撤销或者 pool 已 Stop 时任务直接跳过，panic 会被转换为 PanicError，
+// 执行结果交给 completer，否则出错时记录日志
+func (p *WorkerPool) runTask(task Task) {
+	t, ok := task.(*prioritizedTask)
+	if !ok {
+		t = &prioritizedTask{Task: task}
+	}
+	ctx := t.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var err error
+	// 暂停任务自身监听 ctx 与 stop，必须执行以通知 Pause
+	if !t.internal {
+		err = ctx.Err()
+		if err == nil && p.ctx.Err() != nil {
+			err = ErrStopped // Stop 之后不再开始新的任务
 		}
 	}
+	if err == nil {
+		err = p.doTask(ctx, t)
+	}
+	if !t.internal {
+		p.metrics.finish(err)
+	}
+	if c, ok := t.Task.(completer); ok {
+		c.complete(err)
+		return
+	}
+	if err != nil {
+		log.Error("do task err: ", err)
+	}
+}
+
+// DoContext 执行任务
+func (t *waitTask) DoContext(ctx context.Context) error {
+	if task, ok := t.Task.(ContextTask); ok {
+		return task.DoContext(ctx)
+	}
+	return t.Task.Do()
+}
+
+func (t *waitTask) complete(err error) {
+	if err != nil {
+		log.Error("do task err: ", err)
+	}
+	close(t.done)
+}
+
+func (p *WorkerPool) doTask(ctx context.Context, task *prioritizedTask) (err error) {
+	if task.internal {
+		return task.Do()
+	}
+	if !task.submitted.IsZero() {
+		p.metrics.queueWait.Observe(time.Since(task.submitted))
+	}
+
+	t, ok := task.Task.(ContextTask)
+	if ok {
+		// ctx 在任务自身 ctx 撤销或者 pool 停止时撤销
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-p.ctx.Done():
+				cancel()
+			case <-done:
+			}
+		}()
+		defer func() {
+			close(done)
+			cancel()
+		}()
+	}
+	if p.hooks.beforeTask != nil {
+		ctx = p.hooks.beforeTask(ctx, task.Task)
+	}
+
+	atomic.AddInt64(&p.metrics.running, 1)
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			err = &PanicError{Value: r, Stack: stack}
+			if p.hooks.onPanic != nil {
+				p.hooks.onPanic(task.Task, r, stack)
+			}
+		}
+		latency := time.Since(start)
+		atomic.AddInt64(&p.metrics.running, -1)
+		p.metrics.latency.Observe(latency)
+		if p.hooks.afterTask != nil {
+			p.hooks.afterTask(ctx, task.Task, err, latency)
+		}
+	}()
+
+	if ok {
+		return t.DoContext(ctx)
+	}
+	return task.Task.Do()
 }
 
 func (p *WorkerPool) stop(wait bool) {
@@ -280,26 +592,36 @@ func (p *WorkerPool) stop(wait bool) {
 		p.stopped = true
 		p.stopLock.Unlock()
 		p.wait = wait // 设置是否等待
-		// 关闭任务队列后后不会再接收任务
+		// 等待提交者退出，关闭任务队列后后不会再接收任务
+		p.submitLock.Lock()
 		close(p.taskQueue)
+		p.submitLock.Unlock()
 	})
 	// 阻塞 stop 函数，直到 dispatch 函数完成
 	<-p.stoppedChan
 }
 
-func (p *WorkerPool) processWaitingQueue() bool {
+// processWaitingQueue killQueue 不为 nil 时，worker 超过了最大数，
+// 不再转交任务，而是杀死空闲的 worker
+func (p *WorkerPool) processWaitingQueue(killQueue chan Task) (ok, killed bool) {
+	workerQueue := p.workerQueue
+	if killQueue != nil {
+		workerQueue = nil
+	}
 	select {
 	case task, ok := <-p.taskQueue: // 将任务从 taskQueue 中推出
 		if !ok { // task queue is closed, so return false
-			return false
+			return false, false
 		}
-		p.waitingQueue.PushBack(task) // 然后加入到等待队列
-	case p.workerQueue <- p.waitingQueue.Front().(Task): // 或者将任务从等待队列中推出，然后加入工作队列
+		p.enqueue(task) // 然后加入到等待队列
+	case workerQueue <- p.waitingQueue.front(): // 或者将任务从等待队列中推出，然后加入工作队列
 		// 顶部 job pop
-		p.waitingQueue.PopFront()
+		p.dequeue()
+	case killQueue <- nil:
+		killed = true
+	case <-p.resizeSignal:
 	}
-	atomic.StoreInt32(&p.waiting, int32(p.waitingQueue.Len())) // 更新等待队列个数
-	return true
+	return true, killed
 }
 
 func (p *WorkerPool) killIdleWorker() bool {
@@ -315,7 +637,166 @@ func (p *WorkerPool) killIdleWorker() bool {
 func (p *WorkerPool) runQueuedTasks() {
 	for p.waitingQueue.Len() != 0 {
 		// 等待队列任务中的job出队，然后加入到 worker 队列
-		p.workerQueue <- p.waitingQueue.PopFront().(Task)
-		atomic.StoreInt32(&p.waiting, int32(p.waitingQueue.Len()))
+		p.workerQueue <- p.dequeue()
+	}
+}
+
+// submit 提交任务，队列已满时按拒绝策略处理，nonblocking 为 true 时 RejectBlock 策略不阻塞
+func (p *WorkerPool) submit(task Task, priority int, nonblocking bool) error {
+	if task == nil {
+		return nil
+	}
+	p.submitLock.RLock()
+	defer p.submitLock.RUnlock()
+	select {
+	case <-p.stopSignal:
+		p.reject(task, ErrStopped)
+		return ErrStopped
+	default:
 	}
+
+	t := &prioritizedTask{Task: task, priority: priority, submitted: time.Now()}
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}: // 占用一个空位
+			t.slot = true
+		default:
+			policy := p.rejectPolicy
+			if policy == RejectBlock && nonblocking {
+				policy = RejectDropNewest
+			}
+			switch policy {
+			case RejectBlock:
+				select {
+				case p.slots <- struct{}{}:
+					t.slot = true
+				case <-p.stopSignal:
+					p.reject(task, ErrStopped)
+					return ErrStopped
+				}
+			case RejectDropOldest:
+				t.evict = true // 由 dispatch 丢弃最早的任务，并接管它的空位
+			case RejectCallerRuns:
+				atomic.AddInt64(&p.metrics.submitted, 1)
+				p.runTask(t)
+				return nil
+			case RejectError:
+				log.Error("submit task err: ", ErrRejected)
+				fallthrough
+			default:
+				p.reject(task, ErrRejected)
+				return ErrRejected
+			}
+		}
+	}
+	p.taskQueue <- t // 无需等待
+	atomic.AddInt64(&p.metrics.submitted, 1)
+	return nil
+}
+
+// reject 通知被拒绝、丢弃的任务
+func (p *WorkerPool) reject(task Task, err error) {
+	atomic.AddInt64(&p.metrics.rejected, 1)
+	if c, ok := task.(completer); ok {
+		c.complete(err)
+	}
+}
+
+// release 任务交给 worker 后释放占用的空位
+func (p *WorkerPool) release(task *prioritizedTask) {
+	if task.slot {
+		task.slot = false
+		<-p.slots
+	}
+}
+
+// enqueue 将任务加入等待队列
+func (p *WorkerPool) enqueue(task *prioritizedTask) {
+	if task.evict {
+		p.evictOldest(task)
+	}
+	p.waitingQueue.push(task, &p.seq)
+	atomic.StoreInt32(&p.waiting, int32(p.waitingQueue.Len())) // 更新等待队列个数
+}
+
+// dequeue 取出优先级最高的任务，释放其占用的空位
+func (p *WorkerPool) dequeue() *prioritizedTask {
+	task := p.waitingQueue.pop()
+	atomic.StoreInt32(&p.waiting, int32(p.waitingQueue.Len())) // 更新等待队列个数
+	p.release(task)
+	return task
+}
+
+// evictOldest 丢弃等待队列中最早提交的任务，task 接管其空位
+func (p *WorkerPool) evictOldest(task *prioritizedTask) {
+	task.evict = false
+	oldest := -1
+	for i, t := range p.waitingQueue {
+		if t.slot && (oldest < 0 || t.seq < p.waitingQueue[oldest].seq) {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return
+	}
+	victim := heap.Remove(&p.waitingQueue, oldest).(*prioritizedTask)
+	task.slot, victim.slot = victim.slot, false
+	p.reject(victim.Task, ErrRejected)
+}
+
+// rejectQueuedTasks 不等待时，通知等待队列中的 future 任务已被丢弃
+func (p *WorkerPool) rejectQueuedTasks() {
+	for _, task := range p.waitingQueue {
+		if !task.internal {
+			p.metrics.finish(ErrStopped)
+		}
+		if c, ok := task.Task.(completer); ok {
+			c.complete(ErrStopped)
+		}
+	}
+}
+
+// push 将任务加入等待队列，seq 保证相同优先级的任务按提交顺序执行
+func (h *taskHeap) push(task *prioritizedTask, seq *uint64) {
+	*seq++
+	task.seq = *seq
+	heap.Push(h, task)
+}
+
+// pop 取出优先级最高的任务
+func (h *taskHeap) pop() *prioritizedTask {
+	return heap.Pop(h).(*prioritizedTask)
+}
+
+// front 返回优先级最高的任务
+func (h taskHeap) front() Task {
+	return h[0]
+}
+
+func (h taskHeap) Len() int {
+	return len(h)
+}
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *taskHeap) Push(x any) {
+	*h = append(*h, x.(*prioritizedTask))
+}
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	task := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return task
 }
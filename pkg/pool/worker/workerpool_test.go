@@ -165,13 +165,13 @@ func TestWorkerTimeout(t *testing.T) {
 	}
 
 	// Check that a worker timed out.
-	time.Sleep(idleTimeout*2 + idleTimeout/2)
+	time.Sleep(defaultIdleTimeout*2 + defaultIdleTimeout/2)
 	if countReady(wp) != max-1 {
 		t.Fatal("First worker did not timeout")
 	}
 
 	// Check that another worker timed out.
-	time.Sleep(idleTimeout)
+	time.Sleep(defaultIdleTimeout)
 	if countReady(wp) != max-2 {
 		t.Fatal("Second worker did not timeout")
 	}
@@ -472,6 +472,33 @@ func TestWaitingQueueSizeRace(t *testing.T) {
 	}
 }
 
+func TestPauseDeadlineWhileBusy(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	defer wp.Stop()
+
+	wp.Submit(&fakeTask{
+		fn:  func() { time.Sleep(200 * time.Millisecond) },
+		ctx: context.Background(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	paused := make(chan struct{})
+	go func() {
+		wp.Pause(ctx)
+		close(paused)
+	}()
+
+	// 暂停任务在 ctx 超时后才开始执行，Pause 仍然需要返回
+	select {
+	case <-paused:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pause did not return after its deadline")
+	}
+}
+
 func TestPause(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
@@ -671,6 +698,116 @@ func TestWorkerLeak(t *testing.T) {
 	wp.Stop()
 }
 
+func TestPriority(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	defer wp.Stop()
+
+	// 阻塞唯一的 worker，后面的任务都进入等待队列
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wp.Submit(&fakeTask{
+		fn: func() {
+			close(started)
+			<-release
+		},
+		ctx: context.Background(),
+	})
+	<-started
+
+	var lock sync.Mutex
+	var order []int
+	for i, priority := range []int{0, 5, 1, 5, 0} {
+		i := i
+		wp.SubmitWithPriority(&fakeTask{
+			fn: func() {
+				lock.Lock()
+				order = append(order, i)
+				lock.Unlock()
+			},
+			ctx: context.Background(),
+		}, priority)
+	}
+	for wp.WaitingQueueSize() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wp.StopWait()
+
+	// 优先级高的先执行，相同优先级按提交顺序执行
+	assert.Equal(t, []int{1, 3, 2, 0, 4}, order)
+}
+
+func TestResize(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(1)
+	defer wp.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, max)
+	for i := 0; i < 4; i++ {
+		wp.Submit(&fakeTask{
+			fn: func() {
+				started <- struct{}{}
+				<-release
+			},
+			ctx: context.Background(),
+		})
+	}
+	<-started
+	for wp.WaitingQueueSize() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 扩容之后等待的任务立即开始执行
+	wp.Resize(4)
+	assert.Equal(t, 4, wp.Size())
+	timeout := time.After(time.Second)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-timeout:
+			t.Fatal("timed out waiting for workers to start after resize")
+		}
+	}
+	assert.Equal(t, 0, wp.WaitingQueueSize())
+
+	// 缩容之后多余的 worker 空闲时被停止
+	wp.Resize(0)
+	assert.Equal(t, 1, wp.Size())
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for countReady(wp) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, countReady(wp))
+
+	wp.Stop()
+	// 停止之后 Resize 无效
+	wp.Resize(10)
+	assert.Equal(t, 1, wp.Size())
+}
+
+func TestIdleTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wp := New(max, WithIdleTimeout(10*time.Millisecond))
+	defer wp.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.Pause(ctx)
+	cancel()
+	if countReady(wp) != max {
+		t.Fatal("Expected", max, "ready workers")
+	}
+
+	// 每两个超时周期停止一个空闲的 worker
+	time.Sleep(100 * time.Millisecond)
+	assert.Less(t, countReady(wp), max)
+}
+
 func TestForBreak(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+)
+
+var ErrClosed = errors.New("queue is closed")
+
+// hybridQueue 内存环形队列 + 磁盘溢出
+// 正常情况下数据只在内存 ring 中流转，不需要 fsync；
+// ring 写满后，新数据按批次写入 diskQueue 的块文件，
+// Pop 时再按 FIFO 顺序从磁盘回填到 ring 中。
+//
+// 数据的先后顺序始终是：ring -> disk -> pending
+//
+// Close 时 pending 写入磁盘，ring 保存到 ring 文件，重新打开后从上次 Close 的位置继续；
+// 进程崩溃时会回到上次 Close 的状态，数据可能被重复读取。
+type hybridQueue struct {
+	lock     sync.Mutex
+	elements []string // 环形缓冲区
+	head     int      // 最旧元素的位置
+	size     int      // ring 中的元素个数
+	pending  []string // 等待批量刷盘的数据
+	batch    int
+	disk     *diskQueue
+	closed   bool
+}
+
+// NewHybrid creates a queue that keeps up to size items in memory and
+// spills the overflow to chunk files under path. Items saved by Close are
+// restored, the ring grows if they do not fit in size.
+func NewHybrid(path string, size int, options ...Option) (*hybridQueue, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("size: %d should be greater than 0", size)
+	}
+
+	ops := defaultOptions()
+	for _, option := range options {
+		option(&ops)
+	}
+	if ops.SpillBatch < 1 {
+		ops.SpillBatch = 1
+	}
+
+	disk, err := New(path, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []string
+	if p := ringPath(disk); exists(p) {
+		if err = disk.serializer.Load(p, &saved); err != nil {
+			_ = disk.Close()
+			return nil, fmt.Errorf("load ring err: %s", err)
+		}
+	}
+	if len(saved) > size {
+		size = len(saved)
+	}
+	elements := make([]string, size)
+	copy(elements, saved)
+
+	return &hybridQueue{
+		elements: elements,
+		size:     len(saved),
+		batch:    ops.SpillBatch,
+		disk:     disk,
+	}, nil
+}
+
+func (q *hybridQueue) Push(val string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	// 磁盘或 pending 中还有数据时，新数据不能插队进入 ring
+	if q.disk.Empty() && len(q.pending) == 0 && q.size < len(q.elements) {
+		q.elements[(q.head+q.size)%len(q.elements)] = val
+		q.size++
+		return nil
+	}
+
+	if q.disk.maxSize > 0 && q.disk.qSize()+len(q.pending) >= q.disk.maxSize {
+		return Full
+	}
+	q.pending = append(q.pending, val)
+	if len(q.pending) >= q.batch {
+		return q.spill()
+	}
+	return nil
+}
+
+func (q *hybridQueue) Pop() (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return "", ErrClosed
+	}
+	if q.size == 0 {
+		if err := q.refill(); err != nil {
+			return "", err
+		}
+		if q.size == 0 {
+			return "", Empty
+		}
+	}
+
+	val := q.elements[q.head]
+	q.elements[q.head] = ""
+	q.head = (q.head + 1) % len(q.elements)
+	q.size--
+	return val, nil
+}
+
+func (q *hybridQueue) Empty() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size == 0 && len(q.pending) == 0 && q.disk.Empty()
+}
+
+// Len returns the total number of items, in memory and on disk
+func (q *hybridQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size + len(q.pending) + q.disk.qSize()
+}
+
+// Flush writes pending items to disk
+func (q *hybridQueue) Flush() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	return q.spill()
+}
+
+// Close flushes pending items, saves the items in memory and closes the disk queue
+func (q *hybridQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	err := q.spill()
+	if err == nil {
+		ring := make([]string, q.size)
+		for i := range ring {
+			ring[i] = q.elements[(q.head+i)%len(q.elements)]
+		}
+		err = q.disk.saveFile(ringPath(q.disk), ring)
+	}
+	if cerr := q.disk.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// spill 将 pending 中的数据一次性写入磁盘
+func (q *hybridQueue) spill() error {
+	if len(q.pending) == 0 {
+		return nil
+	}
+	if err := q.disk.pushBatch(q.pending); err != nil {
+		return err
+	}
+	q.pending = q.pending[:0]
+	return nil
+}
+
+// refill 按顺序从磁盘和 pending 中回填 ring
+func (q *hybridQueue) refill() error {
+	for q.size < len(q.elements) {
+		var val string
+		if !q.disk.Empty() {
+			v, err := q.disk.Pop()
+			if err != nil {
+				return err
+			}
+			val = v
+		} else if len(q.pending) > 0 {
+			val = q.pending[0]
+			q.pending = q.pending[1:]
+		} else {
+			break
+		}
+		q.elements[(q.head+q.size)%len(q.elements)] = val
+		q.size++
+	}
+	return nil
+}
+
+func ringPath(disk *diskQueue) string {
+	return path.Join(disk.path, "ring")
+}
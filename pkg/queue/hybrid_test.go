@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	q, err := NewHybrid(t.TempDir(), 4, WithChunkSize(64), WithSpillBatch(3))
+	assert.Nil(err)
+	defer q.Close()
+	assert.True(q.Empty())
+
+	for i := 0; i < 20; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	assert.Equal(20, q.Len())
+
+	// 交替读写，顺序必须保持 FIFO
+	for i := 0; i < 10; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+	for i := 20; i < 25; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	for i := 10; i < 25; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+
+	assert.True(q.Empty())
+	_, err = q.Pop()
+	assert.Equal(Empty, err)
+}
+
+func TestHybridQueue_Full(t *testing.T) {
+	assert := assert.New(t)
+
+	q, err := NewHybrid(t.TempDir(), 2, WithMaxSize(2))
+	assert.Nil(err)
+	defer q.Close()
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	assert.Equal(Full, q.Push("4"))
+
+	val, err := q.Pop()
+	assert.Nil(err)
+	assert.Equal("0", val)
+}
+
+func TestHybridQueue_Reopen(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	q, err := NewHybrid(dir, 4, WithChunkSize(64), WithSpillBatch(3))
+	assert.Nil(err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	for i := 0; i < 1; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+	assert.Nil(q.Close())
+
+	// ring 变小后仍然能恢复所有数据
+	q, err = NewHybrid(dir, 2, WithChunkSize(64), WithSpillBatch(3))
+	assert.Nil(err)
+	defer q.Close()
+	assert.Equal(19, q.Len())
+	for i := 1; i < 20; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+	assert.True(q.Empty())
+}
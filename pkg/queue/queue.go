@@ -4,15 +4,21 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
+	"sync"
 	"syscall"
 	"time"
+
+	jsoniter "github.com/json-iterator/go"
 )
 
 const (
 	itemLengthSize = 4
+
+	defaultGCTimeout = time.Minute
 )
 
 var (
@@ -51,11 +57,14 @@ type (
 		TempDir   string
 		AutoSave  bool
 		GCTimeout time.Duration
+		// SpillBatch 混合队列溢出到磁盘时的批次大小
+		SpillBatch int
 	}
 
 	Option func(*queueOptions)
 
 	diskQueue struct {
+		lock       sync.Mutex
 		path       string
 		maxSize    int
 		chunkSize  int
@@ -67,6 +76,8 @@ type (
 		headFile   *os.File
 		tailFile   *os.File
 		gcTicker   *time.Ticker
+		gcDone     sync.WaitGroup
+		done       chan struct{}
 	}
 )
 
@@ -94,17 +105,29 @@ func WithAutoSave(autoSave bool) Option {
 	}
 }
 
+// WithGCTimeout sets the interval of removing consumed chunk files in
+// background, timeout <= 0 removes them when the head moves to the next chunk.
 func WithGCTimeout(timeout time.Duration) Option {
 	return func(ops *queueOptions) {
 		ops.GCTimeout = timeout
 	}
 }
 
+// WithSpillBatch sets how many items a hybrid queue buffers before
+// writing them to disk with a single fsync.
+func WithSpillBatch(batch int) Option {
+	return func(ops *queueOptions) {
+		ops.SpillBatch = batch
+	}
+}
+
 var defaultOptions = func() queueOptions {
 	return queueOptions{
-		MaxSize:   0,
-		ChunkSize: 100, // TODO
-		AutoSave:  false,
+		MaxSize:    0,
+		ChunkSize:  100, // TODO
+		AutoSave:   false,
+		GCTimeout:  defaultGCTimeout,
+		SpillBatch: 1,
 	}
 }
 
@@ -129,7 +152,7 @@ func New(path string, options ...Option) (*diskQueue, error) {
 		autoSave:   ops.AutoSave,
 		serializer: NewJsonSerializer(),
 		gcTimeout:  ops.GCTimeout,
-		gcTicker:   time.NewTicker(ops.GCTimeout),
+		done:       make(chan struct{}),
 	}
 
 	err := q.init()
@@ -137,36 +160,53 @@ func New(path string, options ...Option) (*diskQueue, error) {
 		return nil, err
 	}
 
-	go q.gc()
+	if q.gcTimeout > 0 {
+		q.gcTicker = time.NewTicker(q.gcTimeout)
+		q.gcDone.Add(1)
+		go q.gc()
+	}
 
 	return q, nil
 }
 
 func (q *diskQueue) Push(val string) error {
-	if q.qSize() >= q.maxSize {
+	return q.pushBatch([]string{val})
+}
+
+// pushBatch 批量写入 tail 文件，整个批次只刷一次盘
+func (q *diskQueue) pushBatch(vals []string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed() {
+		return ErrClosed
+	}
+	if q.maxSize > 0 && q.meta.size+len(vals) > q.maxSize {
 		return Full
 	}
-	data := []byte(val)
-	// 写到 tail 文件
-	if q.meta.tail.length+len(data) > q.meta.chunkSize {
-		if err := q.advanceTail(); err != nil {
-			return fmt.Errorf("advance tail file err: %s", err)
+	for _, val := range vals {
+		data := []byte(val)
+		// 写到 tail 文件
+		size := itemLengthSize + len(data)
+		if q.meta.tail.length > 0 && q.meta.tail.length+size > q.meta.chunkSize {
+			if err := q.advanceTail(); err != nil {
+				return fmt.Errorf("advance tail file err: %s", err)
+			}
 		}
+		lbuf := make([]byte, size)
+		binary.BigEndian.PutUint32(lbuf, uint32(len(data)))
+		copy(lbuf[itemLengthSize:], data)
+		_, err := q.tailFile.Write(lbuf)
+		if err != nil {
+			return fmt.Errorf("write queue data err: %s", err)
+		}
+		q.meta.tail.length += size
+		q.meta.tail.offset += 1
+		q.meta.size++
 	}
-	lbuf := make([]byte, itemLengthSize+len(data))
-	binary.BigEndian.PutUint32(lbuf, uint32(len(data)))
-	copy(lbuf[itemLengthSize:], data)
-	// TODO handle n != len(data) ?
-	/*n,*/ _, err := q.tailFile.Write(lbuf)
-	if err != nil {
-		return fmt.Errorf("write queue data err: %s", err)
-	}
-	q.meta.tail.length += len(data)
-	q.meta.tail.offset += 1
-	q.meta.size++
 
 	// fsync
-	err = syscall.Fsync(int(q.tailFile.Fd()))
+	err := syscall.Fsync(int(q.tailFile.Fd()))
 	if err != nil {
 		return fmt.Errorf("flush queue data file err: %s", err)
 	}
@@ -182,8 +222,9 @@ func (q *diskQueue) advanceTail() error {
 		return fmt.Errorf("flush queue data file err: %s", err)
 	}
 	// 2. 创建新的 tail file
+	_ = q.tailFile.Close()
 	tailPath := q.qFile(q.meta.tail.num + 1)
-	q.tailFile, err = os.OpenFile(tailPath, os.O_RDWR|os.O_CREATE, 0666)
+	q.tailFile, err = os.OpenFile(tailPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("open tail file err: %s", err)
 	}
@@ -196,42 +237,48 @@ func (q *diskQueue) advanceTail() error {
 }
 
 func (q *diskQueue) Pop() (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed() {
+		return "", ErrClosed
+	}
 	// 检查 tail 是否超过了 head
 	err := q.checkEmpty()
 	if err != nil {
 		return "", err
 	}
-	if q.meta.head.length >= q.meta.chunkSize {
-		if err := q.advanceHead(); err != nil {
+
+	lbuf := make([]byte, itemLengthSize)
+	_, err = io.ReadFull(q.headFile, lbuf)
+	// head 文件已读完，切换到下一个块
+	if err == io.EOF && q.meta.head.num < q.meta.tail.num {
+		if err = q.advanceHead(); err != nil {
 			return "", fmt.Errorf("advance head file err: %s", err)
 		}
+		_, err = io.ReadFull(q.headFile, lbuf)
 	}
-
-	lbuf := make([]byte, itemLengthSize)
-	// TODO handle n != len(data) ?
-	_, err = q.headFile.Read(lbuf)
 	if err != nil {
 		return "", fmt.Errorf("read queue file err: %s", err)
 	}
 	length := binary.BigEndian.Uint32(lbuf)
 	dbuf := make([]byte, length)
-	// TODO handle n != len(data) ?
-	_, err = q.headFile.Read(dbuf)
+	_, err = io.ReadFull(q.headFile, dbuf)
 	if err != nil {
 		return "", fmt.Errorf("read queue file err: %s", err)
 	}
-	q.meta.head.offset -= 1
-	q.meta.head.length -= itemLengthSize + int(length)
+	q.meta.head.offset += 1
+	q.meta.head.length += itemLengthSize + int(length)
 	q.meta.size--
 	return string(dbuf), nil
 }
 
 func (q *diskQueue) checkEmpty() error {
-	if q.meta.tail.num > q.meta.head.num {
+	if q.meta.head.num > q.meta.tail.num {
 		return Empty
 	}
 	if q.meta.tail.num == q.meta.head.num &&
-		q.meta.tail.offset >= q.meta.tail.offset {
+		q.meta.head.offset >= q.meta.tail.offset {
 		return Empty
 	}
 	return nil
@@ -245,6 +292,7 @@ func (q *diskQueue) advanceHead() error {
 		return fmt.Errorf("flush queue data file err: %s", err)
 	}
 	// 2. 创建新的 head file
+	_ = q.headFile.Close()
 	headPath := q.qFile(q.meta.head.num + 1)
 	q.headFile, err = os.OpenFile(headPath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
@@ -255,6 +303,12 @@ func (q *diskQueue) advanceHead() error {
 	q.meta.head.num += 1
 	q.meta.head.length = 0
 	q.meta.head.offset = 0
+	// 没有后台 gc 时，直接删除已读完的块
+	if q.gcTimeout <= 0 {
+		if err = os.Remove(q.qFile(q.meta.head.num - 1)); err != nil {
+			log.Printf("[gc] remove unsed file err: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -262,6 +316,46 @@ func (q *diskQueue) Empty() bool {
 	return q.qSize() == 0
 }
 
+// Close stops the gc goroutine, saves the metadata and closes the chunk files,
+// a queue reopened on the same path continues from where it was closed
+func (q *diskQueue) Close() error {
+	q.lock.Lock()
+	if q.closed() {
+		q.lock.Unlock()
+		return nil
+	}
+	close(q.done)
+	q.lock.Unlock()
+
+	// 等待 gc 退出，gc 会获取锁
+	if q.gcTicker != nil {
+		q.gcTicker.Stop()
+		q.gcDone.Wait()
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	err := syscall.Fsync(int(q.tailFile.Fd()))
+	if err != nil {
+		err = fmt.Errorf("flush queue data file err: %s", err)
+	} else {
+		err = q.saveMeta()
+	}
+	_ = q.tailFile.Close()
+	_ = q.headFile.Close()
+	return err
+}
+
+func (q *diskQueue) closed() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
 func (q *diskQueue) init() error {
 	if _, err := os.Stat(q.path); os.IsNotExist(err) {
 		_ = os.MkdirAll(q.path, os.ModePerm)
@@ -278,12 +372,23 @@ func (q *diskQueue) init() error {
 	if err != nil {
 		return fmt.Errorf("open head file err: %s", err)
 	}
+	// 跳过已经读取的数据
+	if _, err = q.headFile.Seek(int64(q.meta.head.length), io.SeekStart); err != nil {
+		return fmt.Errorf("seek head file err: %s", err)
+	}
 
 	tailPath := q.qFile(q.meta.tail.num)
 	q.tailFile, err = os.OpenFile(tailPath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return fmt.Errorf("open tail file err: %s", err)
 	}
+	// 截断 meta 之后的数据，避免读到上次遗留的数据，然后从末尾继续写
+	if err = q.tailFile.Truncate(int64(q.meta.tail.length)); err != nil {
+		return fmt.Errorf("truncate tail file err: %s", err)
+	}
+	if _, err = q.tailFile.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("seek tail file err: %s", err)
+	}
 
 	return nil
 }
@@ -297,20 +402,32 @@ func (q *diskQueue) qFile(number int) string {
 //
 
 func (q *diskQueue) saveMeta() error {
-	temp, err := os.CreateTemp(q.tempDir, "meta")
+	return q.saveFile(q.metaPath(), q.meta)
+}
+
+// saveFile 先写临时文件再 rename，保证 p 要么是旧数据要么是新数据
+func (q *diskQueue) saveFile(p string, val any) error {
+	// 临时文件与 p 在同一目录下，rename 才是原子的
+	temp, err := os.CreateTemp(path.Dir(p), path.Base(p))
 	if err != nil {
-		return fmt.Errorf("create meta temp file err: %s", err)
+		return fmt.Errorf("create %s temp file err: %s", path.Base(p), err)
 	}
+	defer os.Remove(temp.Name())
 
-	err = q.serializer.DumpFile(temp, q.meta)
+	err = q.serializer.DumpFile(temp, val)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		return fmt.Errorf("dump meta to file err: %s", err)
+		return fmt.Errorf("dump %s to file err: %s", path.Base(p), err)
 	}
 
-	p := q.metaPath()
-	err = os.Rename(temp.Name(), p) // FIXME?
+	err = os.Rename(temp.Name(), p)
 	if err != nil {
-		return fmt.Errorf("repalce meta file err: %s", err)
+		return fmt.Errorf("repalce %s file err: %s", path.Base(p), err)
 	}
 
 	return nil
@@ -340,30 +457,79 @@ func (q *diskQueue) loadMeta() *metadata {
 	return meta
 }
 
+type (
+	// cursorJSON, metadataJSON 导出字段后才能被序列化
+	cursorJSON struct {
+		Num    int `json:"num"`
+		Offset int `json:"offset"`
+		Length int `json:"length"`
+	}
+
+	metadataJSON struct {
+		Size      int        `json:"size"`
+		ChunkSize int        `json:"chunk_size"`
+		Head      cursorJSON `json:"head"`
+		Tail      cursorJSON `json:"tail"`
+	}
+)
+
+func (m *metadata) MarshalJSON() ([]byte, error) {
+	return jsoniter.Marshal(metadataJSON{
+		Size:      m.size,
+		ChunkSize: m.chunkSize,
+		Head:      cursorJSON{Num: m.head.num, Offset: m.head.offset, Length: m.head.length},
+		Tail:      cursorJSON{Num: m.tail.num, Offset: m.tail.offset, Length: m.tail.length},
+	})
+}
+
+func (m *metadata) UnmarshalJSON(data []byte) error {
+	var v metadataJSON
+	if err := jsoniter.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.size = v.Size
+	m.chunkSize = v.ChunkSize
+	m.head = &cursor{num: v.Head.Num, offset: v.Head.Offset, length: v.Head.Length}
+	m.tail = &cursor{num: v.Tail.Num, offset: v.Tail.Offset, length: v.Tail.Length}
+	return nil
+}
+
 func (q *diskQueue) metaPath() string {
 	return path.Join(q.path, "meta")
 }
 
 func (q *diskQueue) qSize() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
 	return q.meta.size
 }
 
 func (q *diskQueue) gc() {
+	defer q.gcDone.Done()
 	ticker := q.gcTicker
 	for {
 		select {
 		case <-ticker.C:
 			q.cleanFiles()
+		case <-q.done:
+			return
 		}
 	}
 }
 
 func (q *diskQueue) cleanFiles() {
-	if q.meta.head.num == 0 {
-		return
-	}
+	q.lock.Lock()
+	head := q.meta.head.num
+	q.lock.Unlock()
+
+	q.removeFiles(head)
+}
+
+// removeFiles 删除序号小于 head 的块文件
+func (q *diskQueue) removeFiles(head int) {
 	// chunk size 的作用就在这里，清理的时候，可以容忍一定长度上的浪费
-	for i := 0; i < q.meta.head.num; i++ {
+	for i := 0; i < head; i++ {
 		abandonPath := q.qFile(i)
 		if exist := exists(abandonPath); exist {
 			err := os.Remove(abandonPath)
@@ -372,5 +538,4 @@ func (q *diskQueue) cleanFiles() {
 			}
 		}
 	}
-	return
 }
@@ -2,9 +2,12 @@ package queue
 
 import (
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 )
 
 func TestNew(t *testing.T) {
@@ -12,6 +15,8 @@ func TestNew(t *testing.T) {
 
 	queue, err := New("./test")
 	assert.Nil(t, err)
+	defer os.RemoveAll("./test")
+	defer queue.Close()
 	assert.Truef(t, queue.Empty(), "queue must be empty")
 
 	err = queue.Push("helloworld")
@@ -27,3 +32,63 @@ func TestNew(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equalf(t, val, "pedro", "val must be pedro")
 }
+
+func TestDiskQueue_Reopen(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	q, err := New(dir, WithChunkSize(32))
+	assert.Nil(err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	for i := 0; i < 3; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+	assert.Nil(q.Close())
+	assert.Equal(ErrClosed, q.Push("10"))
+
+	q, err = New(dir, WithChunkSize(32))
+	assert.Nil(err)
+	defer q.Close()
+	assert.Nil(q.Push("10"))
+	for i := 3; i <= 10; i++ {
+		val, err := q.Pop()
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i), val)
+	}
+	assert.True(q.Empty())
+}
+
+func TestDiskQueue_GC(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	q, err := New(dir, WithChunkSize(8), WithGCTimeout(time.Millisecond))
+	assert.Nil(err)
+	for i := 0; i < 4; i++ {
+		assert.Nil(q.Push(strconv.Itoa(i)))
+	}
+	for i := 0; i < 4; i++ {
+		_, err = q.Pop()
+		assert.Nil(err)
+	}
+	// 已读完的块被后台 gc 删除
+	assert.Eventually(func() bool {
+		return !exists(q.qFile(0))
+	}, time.Second, time.Millisecond)
+	assert.Nil(q.Close())
+
+	// 关闭后台 gc 时，读完的块直接被删除
+	q, err = New(t.TempDir(), WithChunkSize(8), WithGCTimeout(0))
+	assert.Nil(err)
+	defer q.Close()
+	assert.Nil(q.Push("0"))
+	assert.Nil(q.Push("1"))
+	_, _ = q.Pop()
+	_, _ = q.Pop()
+	assert.False(exists(q.qFile(0)))
+}
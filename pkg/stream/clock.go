@@ -0,0 +1,216 @@
+package stream
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Clock provides the time for time based operators, it can be replaced
+	// by a FakeClock so that windows are tested deterministically.
+	Clock interface {
+		Now() time.Time
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Timer is the timer created by Clock.
+	Timer interface {
+		C() <-chan time.Time
+		// Reset changes the timer to expire after d, a pending expiration is discarded.
+		Reset(d time.Duration)
+		Stop()
+	}
+
+	// Ticker is the ticker created by Clock.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	realClock struct{}
+
+	realTimer struct {
+		timer *time.Timer
+	}
+
+	realTicker struct {
+		ticker *time.Ticker
+	}
+
+	// FakeClock is a Clock that only moves forward with Advance.
+	FakeClock struct {
+		lock   sync.Mutex
+		now    time.Time
+		timers map[*fakeTimer]struct{}
+	}
+
+	// fakeTimer period 大于 0 时是 ticker
+	fakeTimer struct {
+		clock   *FakeClock
+		when    time.Time
+		period  time.Duration
+		c       chan time.Time
+		stopped chan struct{}
+	}
+)
+
+// RealClock returns the Clock backed by the time package.
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Reset(d time.Duration) {
+	t.Stop()
+	t.timer.Reset(d)
+}
+
+func (t *realTimer) Stop() {
+	if !t.timer.Stop() {
+		// 丢弃已经到期但还没被读取的值
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// NewFakeClock creates a FakeClock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.newTimer(d, 0)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return c.newTimer(d, d)
+}
+
+func (c *FakeClock) newTimer(d, period time.Duration) *fakeTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{
+		clock:   c,
+		when:    c.now.Add(d),
+		period:  period,
+		c:       make(chan time.Time),
+		stopped: make(chan struct{}),
+	}
+	c.timers[t] = struct{}{}
+	return t
+}
+
+// Advance moves the clock forward by d and fires the expired timers and tickers in order,
+// it blocks until every tick has been received or the timer is stopped.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	c.lock.Unlock()
+
+	for {
+		t, when, stopped, ok := c.next()
+		if !ok {
+			return
+		}
+		// 阻塞到 tick 被读取，测试可以确定地知道窗口已经关闭
+		select {
+		case t.c <- when:
+		case <-stopped:
+		}
+	}
+}
+
+// next 取出最早到期的 timer，ticker 则调度到下一个周期
+func (c *FakeClock) next() (*fakeTimer, time.Time, chan struct{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var next *fakeTimer
+	for t := range c.timers {
+		if !t.when.After(c.now) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil, time.Time{}, nil, false
+	}
+
+	when := next.when
+	if next.period > 0 {
+		next.when = when.Add(next.period)
+	} else {
+		delete(c.timers, next)
+	}
+	return next, when, next.stopped, true
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.stop()
+	t.when = t.clock.now.Add(d)
+	t.stopped = make(chan struct{})
+	t.clock.timers[t] = struct{}{}
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.stop()
+}
+
+// stop 需要持有锁
+func (t *fakeTimer) stop() {
+	select {
+	case <-t.stopped:
+	default:
+		close(t.stopped)
+	}
+	delete(t.clock.timers, t)
+}
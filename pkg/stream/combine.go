@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/pedrogao/plib/pkg/hash"
+)
+
+// Pair is a pair of items zipped from two streams.
+type Pair[A, B Item] struct {
+	First  A
+	Second B
+}
+
+// Merge merges the items of s and streams, unlike Concat, the sources that
+// have items ready are read in turn, so a busy source can't starve the others.
+// The error of any input cancels the merged stream and is returned by its Err.
+func (s Stream[T]) Merge(streams ...Stream[T]) Stream[T] {
+	all := append([]Stream[T]{s}, streams...)
+	cases := make([]reflect.SelectCase, len(all))
+	upstream := make([]func(), len(all))
+	inputs := make([]*pipeline, len(all))
+	for i, stream := range all {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(stream.source),
+		}
+		upstream[i] = stream.stop
+		inputs[i] = stream.p
+	}
+
+	source := make(chan T)
+	st := newStage(s.p, "Merge", source, upstream...)
+	st.follow(inputs...)
+	go func() {
+		defer st.finish()
+		active := len(cases)
+		next := 0
+		for active > 0 {
+			i, v, ok := receiveFair(cases, next)
+			if !ok {
+				// 忽略已经关闭的源
+				cases[i].Chan = reflect.Value{}
+				active--
+				continue
+			}
+			next = (i + 1) % len(cases)
+			item, _ := v.Interface().(T)
+			if !send(st, source, item) {
+				return
+			}
+		}
+	}()
+	return derive(s, source, st)
+}
+
+// receiveFair 从 next 开始依次尝试非阻塞读取，都没有数据时阻塞等待任意一个源
+func receiveFair(cases []reflect.SelectCase, next int) (int, reflect.Value, bool) {
+	for j := range cases {
+		i := (next + j) % len(cases)
+		if !cases[i].Chan.IsValid() {
+			continue
+		}
+		// 读取会阻塞时 v 是零值，源已关闭时 v 是元素类型的零值
+		if v, ok := cases[i].Chan.TryRecv(); v.IsValid() {
+			return i, v, ok
+		}
+	}
+	return reflect.Select(cases)
+}
+
+// Zip pairs the items of a and b in order, it ends when either stream ends,
+// the error of either stream is returned by the Err of the zipped stream.
+func Zip[A, B Item](a Stream[A], b Stream[B]) Stream[Pair[A, B]] {
+	source := make(chan Pair[A, B])
+	st := newStage(a.p, "Zip", source, a.stop, b.stop)
+	st.follow(b.p)
+	go func() {
+		defer st.finish()
+		// 任意一个流结束后，另一个流剩下的元素不再需要
+		defer a.stop()
+		defer b.stop()
+		for first := range a.source {
+			second, ok := <-b.source
+			if !ok {
+				return
+			}
+			if !send(st, source, Pair[A, B]{First: first, Second: second}) {
+				return
+			}
+		}
+	}()
+	return derive(a, source, st)
+}
+
+// Partition splits s into n streams, items with the same key go to the same stream.
+// All the streams must be consumed concurrently, a full stream blocks the others,
+// use WithBuffer to customize the buffer of each stream.
+func Partition[T Item](s Stream[T], n int, keyFunc KeyFunc[T, string], opts ...Option) []Stream[T] {
+	if n < 1 {
+		panic("n must be greater than 0")
+	}
+	return split(s, "Partition", n, func(item T, write func(i int) bool) bool {
+		i := hash.Murmur332([]byte(keyFunc(item)), hash.DefaultSeed) % uint32(n)
+		return write(int(i))
+	}, opts...)
+}
+
+// Tee broadcasts every item of s to n streams. All the streams must be consumed
+// concurrently, a full stream blocks the others, use WithBuffer to customize
+// the buffer of each stream.
+func Tee[T Item](s Stream[T], n int, opts ...Option) []Stream[T] {
+	if n < 1 {
+		panic("n must be greater than 0")
+	}
+	return split(s, "Tee", n, func(item T, write func(i int) bool) bool {
+		ok := false
+		for i := 0; i < n; i++ {
+			// 停止的输出直接跳过，只要还有输出在消费就继续
+			if write(i) {
+				ok = true
+			}
+		}
+		return ok
+	}, opts...)
+}
+
+// split 将 s 的元素分发到 n 个输出，route 返回 false 表示所有输出都已停止；
+// 每个输出可以单独停止，所有输出都停止之后才停止 s
+func split[T Item](s Stream[T], name string, n int, route func(item T, write func(i int) bool) bool,
+	opts ...Option) []Stream[T] {
+	option := buildOptions(opts...)
+	var stopped int32
+	release := func() {
+		if atomic.AddInt32(&stopped, 1) == int32(n) {
+			s.stop()
+		}
+	}
+
+	outs := make([]chan T, n)
+	stages := make([]*stage, n)
+	streams := make([]Stream[T], n)
+	for i := range outs {
+		outs[i] = make(chan T, option.buffer)
+		stages[i] = newStage(s.p, fmt.Sprintf("%s[%d]", name, i), outs[i], release)
+		streams[i] = derive(s, outs[i], stages[i])
+	}
+
+	go func() {
+		defer func() {
+			for _, st := range stages {
+				st.finish()
+			}
+		}()
+		for item := range s.source {
+			item := item
+			if !route(item, func(i int) bool {
+				return !stages[i].stopped() && send(stages[i], outs[i], item)
+			}) && allStopped(stages) {
+				return
+			}
+		}
+	}()
+	return streams
+}
+
+func allStopped(stages []*stage) bool {
+	for _, st := range stages {
+		if !st.stopped() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMerge(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// 都有数据时轮流读取
+	items := Collect(Just(1, 1, 1, 1).Merge(Just(2, 2), Just(3)))
+	assert.Equal(t, []int{1, 2, 3, 1, 2, 1, 1}, items)
+}
+
+func TestMergeStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	merged := FromContext(context.Background(), naturals).Merge(FromContext(context.Background(), naturals))
+	// 无缓冲的源不一定同时就绪，只检查停止之后没有泄漏
+	assert.Len(t, Collect(merged.Head(4)), 4)
+}
+
+func TestMergeInputError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	failed := FromContext(context.Background(), naturals).MapE(func(item int) (int, error) {
+		if item == 3 {
+			return 0, errDummy
+		}
+		return item, nil
+	})
+	// 出错的不是第一个输入，合并的流同样被取消
+	merged := FromContext(context.Background(), naturals).Merge(failed)
+	merged.Done()
+	assert.Equal(t, errDummy, merged.Err())
+}
+
+func TestZip(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pairs := Collect(Zip(Just(1, 2, 3), Just("a", "b")))
+	assert.Equal(t, []Pair[int, string]{{First: 1, Second: "a"}, {First: 2, Second: "b"}}, pairs)
+
+	// 另一个流是无限的
+	pairs = Collect(Zip(FromContext(context.Background(), naturals), Just("a", "b")))
+	assert.Equal(t, []Pair[int, string]{{First: 0, Second: "a"}, {First: 1, Second: "b"}}, pairs)
+}
+
+func TestZipInputError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	failed := Just("a", "b", "c").WalkE(func(item string, pip chan<- string) error {
+		return errDummy
+	})
+	zipped := Zip(FromContext(context.Background(), naturals), failed)
+	assert.Empty(t, Collect(zipped))
+	assert.Equal(t, errDummy, zipped.Err())
+}
+
+func TestPartition(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var items []int
+	for i := 0; i < 100; i++ {
+		items = append(items, i)
+	}
+	key := func(item int) string {
+		return strconv.Itoa(item % 10)
+	}
+	streams := Partition(Just(items...), 3, key, WithBuffer(0))
+	assert.Len(t, streams, 3)
+
+	results := make([][]int, len(streams))
+	var wg sync.WaitGroup
+	for i, stream := range streams {
+		i, stream := i, stream
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Collect(stream)
+		}()
+	}
+	wg.Wait()
+
+	var all []int
+	owner := make(map[string]int)
+	for i, result := range results {
+		for _, item := range result {
+			// 同一个 key 只会出现在一个分区中
+			if j, ok := owner[key(item)]; ok {
+				assert.Equal(t, j, i)
+			}
+			owner[key(item)] = i
+		}
+		all = append(all, result...)
+	}
+	sort.Ints(all)
+	assert.Equal(t, items, all)
+	assert.Panics(t, func() {
+		Partition(Just(1), 0, key)
+	})
+}
+
+func TestTee(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	streams := Tee(Just(1, 2, 3, 4), 3, WithBuffer(1))
+	var wg sync.WaitGroup
+	results := make([][]int, len(streams))
+	for i, stream := range streams {
+		i, stream := i, stream
+		// 第一个消费者只取一个元素，不影响其他消费者
+		if i == 0 {
+			stream = stream.Head(1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Collect(stream)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, [][]int{{1}, {1, 2, 3, 4}, {1, 2, 3, 4}}, results)
+}
+
+func TestTeeStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	streams := Tee(FromContext(context.Background(), naturals), 2)
+	var wg sync.WaitGroup
+	results := make([][]int, len(streams))
+	for i, stream := range streams {
+		i, stream := i, stream
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Collect(stream.Head(int64(i + 2)))
+		}()
+	}
+	// 所有输出都停止之后，源也会停止
+	wg.Wait()
+	assert.Equal(t, [][]int{{0, 1}, {0, 1, 2}}, results)
+}
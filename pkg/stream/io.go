@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/plib/pkg/queue"
+)
+
+// Lines creates a stream of the lines read from r, without the line endings.
+// A read error cancels the pipeline and is returned by Err.
+func Lines(r io.Reader) Stream[string] {
+	return fromContextE(context.Background(), func(ctx context.Context, source chan<- string) error {
+		// 不使用 bufio.Scanner，避免超长的行报错
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("read line err: %s", err)
+			}
+			if err == io.EOF && len(line) == 0 {
+				return nil
+			}
+
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			select {
+			case source <- line:
+			case <-ctx.Done():
+				return nil
+			}
+			if err == io.EOF {
+				return nil
+			}
+		}
+	})
+}
+
+// Glob creates a stream of the file names matching pattern in lexical order,
+// see filepath.Glob for the pattern syntax.
+func Glob(pattern string) Stream[string] {
+	return fromContextE(context.Background(), func(ctx context.Context, source chan<- string) error {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("glob %s err: %s", pattern, err)
+		}
+		for _, match := range matches {
+			select {
+			case source <- match:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// FromChan creates a stream of the items received from ch until it is closed or ctx is done.
+// Unlike Range, ch is not drained once the stream is stopped, so it can be shared,
+// but an item received just before the stream is stopped is lost.
+func FromChan[T Item](ctx context.Context, ch <-chan T) Stream[T] {
+	return FromContext(ctx, func(ctx context.Context, source chan<- T) {
+		for {
+			// ch 和 ctx 同时就绪时 select 是随机的，先检查 ctx
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case item, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case source <- item:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// FromQueue creates a stream of the items popped from q. If poll is positive, an empty q is
+// polled every poll until ctx is done, otherwise the stream ends once q is empty.
+// An item popped just before the stream is stopped is lost.
+func FromQueue(ctx context.Context, q queue.Queue, poll time.Duration) Stream[string] {
+	return fromContextE(ctx, func(ctx context.Context, source chan<- string) error {
+		for {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			item, err := q.Pop()
+			if errors.Is(err, queue.Empty) {
+				if poll <= 0 || !sleepContext(ctx, poll) {
+					return nil
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("pop queue err: %s", err)
+			}
+
+			select {
+			case source <- item:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
+
+// WriteLines writes every item of s as a line to w, it returns the first
+// error of writing or of the pipeline.
+func WriteLines(s Stream[string], w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for line := range s.source {
+		if _, err := writer.WriteString(line + "\n"); err != nil {
+			return s.abort(fmt.Errorf("write line err: %s", err))
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return s.abort(fmt.Errorf("flush lines err: %s", err))
+	}
+	return s.Err()
+}
+
+// ToQueue pushes every item of s into q, it returns the first error of
+// pushing or of the pipeline.
+func ToQueue(s Stream[string], q queue.Queue) error {
+	for item := range s.source {
+		if err := q.Push(item); err != nil {
+			return s.abort(fmt.Errorf("push queue err: %s", err))
+		}
+	}
+	return s.Err()
+}
+
+// abort cancels the pipeline with err and stops s
+func (s Stream[T]) abort(err error) error {
+	s.p.fail(err)
+	s.stop()
+	return err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/pedrogao/plib/pkg/queue"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errDummy
+}
+
+func TestLines(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	lines := Lines(strings.NewReader("a\r\nb\n\nc"))
+	assert.Equal(t, []string{"a", "b", "", "c"}, Collect(lines))
+	assert.Nil(t, lines.Err())
+
+	// 读取错误
+	lines = Lines(iotest.ErrReader(errDummy))
+	assert.Empty(t, Collect(lines))
+	assert.ErrorContains(t, lines.Err(), errDummy.Error())
+
+	// 提前停止
+	long := strings.Repeat("line\n", 1000)
+	assert.Equal(t, []string{"line", "line"}, Collect(Lines(strings.NewReader(long)).Head(2)))
+}
+
+func TestGlob(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.log", "a.log", "c.txt"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	files := Collect(Glob(filepath.Join(dir, "*.log")))
+	assert.Equal(t, []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}, files)
+
+	stream := Glob("[")
+	assert.Empty(t, Collect(stream))
+	assert.ErrorContains(t, stream.Err(), "syntax error")
+}
+
+func TestFromChan(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ch := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		ch <- i
+	}
+	assert.Equal(t, []int{0, 1}, Collect(FromChan(context.Background(), ch).Head(2)))
+	// 停止之后不会排空 ch，最多丢失一个已经读取的元素
+	assert.GreaterOrEqual(t, len(ch), 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream := FromChan(ctx, ch)
+	assert.Empty(t, Collect(stream))
+	assert.True(t, errors.Is(stream.Err(), context.Canceled))
+}
+
+func TestQueue(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	q, err := queue.New(t.TempDir(), queue.WithTempDir(t.TempDir()))
+	assert.Nil(t, err)
+	defer q.Close()
+
+	assert.Nil(t, ToQueue(Just("a", "b", "c"), q))
+	assert.Equal(t, []string{"a", "b", "c"}, Collect(FromQueue(context.Background(), q, 0)))
+
+	// 轮询空队列直到 ctx 结束
+	assert.Nil(t, q.Push("d"))
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := FromQueue(ctx, q, time.Millisecond)
+	item := <-stream.source
+	cancel()
+	assert.Equal(t, "d", item)
+	assert.Empty(t, Collect(stream))
+}
+
+func TestWriteLines(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteLines(Just("a", "b"), &buf))
+	assert.Equal(t, "a\nb\n", buf.String())
+
+	// 写入失败时停止无限的上游
+	lines := Map(FromContext(context.Background(), naturals), func(item int) string {
+		return strconv.Itoa(item)
+	}, WithWorkers(1))
+	err := WriteLines(lines, failWriter{})
+	assert.ErrorContains(t, err, errDummy.Error())
+	assert.Equal(t, err, lines.Err())
+}
@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/pedrogao/plib/pkg/internal/metrics"
+)
+
+type (
+	// Callback receives the events of the observed stages, it must be safe for concurrent use.
+	Callback interface {
+		// OnProcess is called after a worker of a Walk like stage processed an item,
+		// latency includes the time blocked on writing the results.
+		OnProcess(stage string, latency time.Duration)
+		// OnEmit is called after a stage emitted an item, backlog is the number of items
+		// still buffered in its output, blocked is how long it waited for the next stage.
+		OnEmit(stage string, backlog int, blocked time.Duration)
+	}
+
+	// Observer records the metrics of the stages of the pipelines it observes,
+	// see Stream.Observe.
+	Observer struct {
+		lock      sync.Mutex
+		stages    []*stageMetrics
+		callbacks []Callback
+	}
+
+	// StageStats is the snapshot of the metrics of a stage.
+	StageStats struct {
+		// Name is the index of the stage in the order of creation and the operator name.
+		Name string `json:"name"`
+		// Emitted is the number of items written to the next stage.
+		Emitted int64 `json:"emitted"`
+		// Processed is the number of items processed by the workers of Walk like stages.
+		Processed int64 `json:"processed"`
+		// Workers is the number of workers of Walk like stages, 0 if unlimited.
+		Workers int `json:"workers"`
+		// Utilization is the busy time of workers divided by the time they could work.
+		Utilization float64 `json:"utilization"`
+		// Backlog is the number of items buffered in the output.
+		Backlog int `json:"backlog"`
+		// MaxBacklog is the max backlog seen when emitting.
+		MaxBacklog int `json:"maxBacklog"`
+		// Blocked is the total time spent waiting for the next stage.
+		Blocked time.Duration `json:"blocked"`
+		// Latency is the histogram of the processing time of Walk like stages.
+		Latency HistogramStats `json:"latency"`
+	}
+
+	// HistogramStats is the snapshot of a latency histogram.
+	HistogramStats = metrics.HistogramStats
+
+	// Bucket is a bucket of the histogram, Le of the last bucket is 0 which means +Inf.
+	Bucket = metrics.Bucket
+
+	stageMetrics struct {
+		observer   *Observer
+		name       string
+		backlog    func() int
+		workers    int64
+		emitted    int64
+		processed  int64
+		maxBacklog int64
+		blocked    int64
+		busy       int64
+		first      int64
+		last       int64
+		latency    metrics.Histogram
+	}
+)
+
+// NewObserver creates an Observer, the callbacks receive every event of the observed stages.
+func NewObserver(callbacks ...Callback) *Observer {
+	return &Observer{
+		callbacks: callbacks,
+	}
+}
+
+// Observe lets o record the metrics of the stages created after it on the pipeline of s.
+func (s Stream[T]) Observe(o *Observer) Stream[T] {
+	s.p.observer = o
+	return s
+}
+
+// Stats returns the metrics of all the observed stages in the order of creation.
+func (o *Observer) Stats() []StageStats {
+	o.lock.Lock()
+	stages := make([]*stageMetrics, len(o.stages))
+	copy(stages, o.stages)
+	o.lock.Unlock()
+
+	stats := make([]StageStats, len(stages))
+	for i, m := range stages {
+		stats[i] = m.stats()
+	}
+	return stats
+}
+
+// MarshalJSON dumps the metrics of the stages as json.
+func (o *Observer) MarshalJSON() ([]byte, error) {
+	return jsoniter.Marshal(o.Stats())
+}
+
+// WriteText dumps the metrics of the stages as a table.
+func (o *Observer) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tEMITTED\tPROCESSED\tWORKERS\tUTIL\tBACKLOG\tMAX_BACKLOG\tBLOCKED\tP50\tP99\tMAX")
+	for _, s := range o.Stats() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			s.Name, s.Emitted, s.Processed, s.Workers, s.Utilization*100, s.Backlog, s.MaxBacklog,
+			s.Blocked, s.Latency.P50, s.Latency.P99, s.Latency.Max)
+	}
+	return tw.Flush()
+}
+
+func (o *Observer) register(name string, backlog func() int) *stageMetrics {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	m := &stageMetrics{
+		observer: o,
+		// 同一个算子可能出现多次，加上序号区分
+		name:    fmt.Sprintf("%d:%s", len(o.stages), name),
+		backlog: backlog,
+	}
+	o.stages = append(o.stages, m)
+	return m
+}
+
+func (m *stageMetrics) emit(backlog int, blocked time.Duration) {
+	atomic.AddInt64(&m.emitted, 1)
+	atomic.AddInt64(&m.blocked, int64(blocked))
+	metrics.StoreMax(&m.maxBacklog, int64(backlog))
+	for _, callback := range m.observer.callbacks {
+		callback.OnEmit(m.name, backlog, blocked)
+	}
+}
+
+func (m *stageMetrics) process(start, end time.Time) {
+	latency := end.Sub(start)
+	atomic.AddInt64(&m.processed, 1)
+	atomic.AddInt64(&m.busy, int64(latency))
+	atomic.CompareAndSwapInt64(&m.first, 0, start.UnixNano())
+	metrics.StoreMax(&m.last, end.UnixNano())
+	m.latency.Observe(latency)
+	for _, callback := range m.observer.callbacks {
+		callback.OnProcess(m.name, latency)
+	}
+}
+
+func (m *stageMetrics) stats() StageStats {
+	workers := int(atomic.LoadInt64(&m.workers))
+	stats := StageStats{
+		Name:       m.name,
+		Emitted:    atomic.LoadInt64(&m.emitted),
+		Processed:  atomic.LoadInt64(&m.processed),
+		Workers:    workers,
+		Backlog:    m.backlog(),
+		MaxBacklog: int(atomic.LoadInt64(&m.maxBacklog)),
+		Blocked:    time.Duration(atomic.LoadInt64(&m.blocked)),
+		Latency:    m.latency.Stats(),
+	}
+	// 利用率 = 忙碌时间 / (worker 数 * 第一个元素开始到最后一个元素结束的时间)
+	elapsed := atomic.LoadInt64(&m.last) - atomic.LoadInt64(&m.first)
+	if workers > 0 && elapsed > 0 {
+		stats.Utilization = math.Min(1, float64(atomic.LoadInt64(&m.busy))/float64(int64(workers)*elapsed))
+	}
+	return stats
+}
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type recordCallback struct {
+	lock      sync.Mutex
+	processed map[string]int
+	emitted   map[string]int
+}
+
+func (c *recordCallback) OnProcess(stage string, latency time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.processed[stage]++
+}
+
+func (c *recordCallback) OnEmit(stage string, backlog int, blocked time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.emitted[stage]++
+}
+
+func TestObserver(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	callback := &recordCallback{
+		processed: make(map[string]int),
+		emitted:   make(map[string]int),
+	}
+	o := NewObserver(callback)
+	s := Just(1, 2, 3, 4, 5, 6).Observe(o).Map(func(item int) int {
+		time.Sleep(time.Millisecond)
+		return item * 2
+	}, WithWorkers(2)).Filter(func(item int) bool {
+		return item > 4
+	}, WithName("big"))
+	assert.ElementsMatch(t, []int{6, 8, 10, 12}, Collect(s.Head(10)))
+
+	stats := o.Stats()
+	assert.Len(t, stats, 3)
+	assert.Equal(t, "0:Map", stats[0].Name)
+	assert.Equal(t, int64(6), stats[0].Processed)
+	assert.Equal(t, int64(6), stats[0].Emitted)
+	assert.Equal(t, 2, stats[0].Workers)
+	assert.Greater(t, stats[0].Utilization, 0.0)
+	assert.Equal(t, int64(6), stats[0].Latency.Count)
+	assert.GreaterOrEqual(t, stats[0].Latency.Max, time.Millisecond)
+	assert.GreaterOrEqual(t, stats[0].Latency.P99, stats[0].Latency.P50)
+	assert.Equal(t, "1:big", stats[1].Name)
+	assert.Equal(t, int64(4), stats[1].Emitted)
+	assert.Equal(t, "2:Head", stats[2].Name)
+	assert.Equal(t, int64(0), stats[2].Processed)
+
+	callback.lock.Lock()
+	assert.Equal(t, 6, callback.processed["0:Map"])
+	assert.Equal(t, 4, callback.emitted["1:big"])
+	callback.lock.Unlock()
+
+	var buf bytes.Buffer
+	assert.Nil(t, o.WriteText(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), "STAGE"))
+	assert.Contains(t, buf.String(), "1:big")
+
+	data, err := jsoniter.Marshal(o)
+	assert.Nil(t, err)
+	var decoded []StageStats
+	assert.Nil(t, jsoniter.Unmarshal(data, &decoded))
+	assert.Equal(t, stats[1].Emitted, decoded[1].Emitted)
+}
+
+func TestObserverStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	o := NewObserver()
+	s := FromContext(context.Background(), naturals).Observe(o).Map(func(item int) int {
+		return item
+	}, WithWorkers(1))
+	assert.Equal(t, []int{0, 1, 2}, Collect(s.Head(3)))
+	stats := o.Stats()
+	assert.Len(t, stats, 2)
+	assert.GreaterOrEqual(t, stats[0].Emitted, int64(3))
+	assert.Equal(t, int64(3), stats[1].Emitted)
+}
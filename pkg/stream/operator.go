@@ -0,0 +1,63 @@
+package stream
+
+import "github.com/pedrogao/plib/pkg/common"
+
+// 方法不能声明额外的类型参数，改变元素类型的操作以包级函数的形式提供
+
+// Map converts every item of s with fn, the result may be of another type.
+func Map[T, R Item](s Stream[T], fn MapFunc[T, R], opts ...Option) Stream[R] {
+	return walk(s, func(item T, pip chan<- R) {
+		pip <- fn(item)
+	}, withName("Map", opts)...)
+}
+
+// FlatMap converts every item of s into zero or more items.
+func FlatMap[T, R Item](s Stream[T], fn func(item T) []R, opts ...Option) Stream[R] {
+	return walk(s, func(item T, pip chan<- R) {
+		for _, r := range fn(item) {
+			pip <- r
+		}
+	}, withName("FlatMap", opts)...)
+}
+
+// Reduce folds all items of s into a single value, starting from initial.
+func Reduce[T, R Item](s Stream[T], initial R, fn func(acc R, item T) R) R {
+	acc := initial
+	for item := range s.source {
+		acc = fn(acc, item)
+	}
+	return acc
+}
+
+// GroupBy groups all items of s by the key returned from fn,
+// items in each group keep the order they come from s.
+func GroupBy[T Item, K comparable](s Stream[T], fn KeyFunc[T, K]) map[K][]T {
+	groups := make(map[K][]T)
+	for item := range s.source {
+		key := fn(item)
+		groups[key] = append(groups[key], item)
+	}
+	return groups
+}
+
+// Distinct keeps the first item of every key returned from fn.
+func Distinct[T Item, K comparable](s Stream[T], fn KeyFunc[T, K]) Stream[T] {
+	keys := make(map[K]common.PlaceholderType)
+	return distinct(s, func(item T) (bool, error) {
+		key := fn(item)
+		if _, ok := keys[key]; ok {
+			return false, nil
+		}
+		keys[key] = common.Placeholder
+		return true, nil
+	})
+}
+
+// Collect reads all items of s into a slice.
+func Collect[T Item](s Stream[T]) []T {
+	var items []T
+	for item := range s.source {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	items := Collect(Map(Just(1, 2, 3), func(item int) string {
+		return strconv.Itoa(item * 10)
+	}))
+	sort.Strings(items)
+	assert.Equal(t, []string{"10", "20", "30"}, items)
+}
+
+func TestFlatMap(t *testing.T) {
+	// 元素可以是 slice 这类不可比较的类型
+	items := Collect(FlatMap(Just([]string{"a", "b"}, []string{"c"}), func(item []string) []string {
+		return item
+	}, WithWorkers(1)))
+	assert.Equal(t, []string{"a", "b", "c"}, items)
+}
+
+func TestReduce(t *testing.T) {
+	sum := Reduce(Just("1", "2", "3"), 0, func(acc int, item string) int {
+		v, _ := strconv.Atoi(item)
+		return acc + v
+	})
+	assert.Equal(t, 6, sum)
+}
+
+func TestGroupBy(t *testing.T) {
+	words := Map(Just("apple", "avocado", "banana", "blueberry", "cherry"), func(item string) []string {
+		return []string{item[:1], item}
+	}, WithWorkers(1))
+	groups := GroupBy(words, func(item []string) string {
+		return item[0]
+	})
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, [][]string{{"a", "apple"}, {"a", "avocado"}}, groups["a"])
+	assert.Equal(t, [][]string{{"c", "cherry"}}, groups["c"])
+}
+
+func TestCollect(t *testing.T) {
+	lines := Collect(Just(strings.Split("a\nb\nc", "\n")...))
+	assert.Equal(t, []string{"a", "b", "c"}, lines)
+}
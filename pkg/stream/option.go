@@ -4,6 +4,12 @@ type (
 	rxOptions struct {
 		unlimitedWorkers bool
 		workers          int
+		ordered          bool
+		clock            Clock
+		buffer           int
+		memoryLimit      int
+		tempDir          string
+		name             string
 	}
 
 	Option func(opts *rxOptions)
@@ -16,6 +22,60 @@ func UnlimitedWorkers() Option {
 	}
 }
 
+// Ordered lets the workers run concurrently but emit results in the source order,
+// at most workers items are buffered for re-sequencing.
+func Ordered() Option {
+	return func(opts *rxOptions) {
+		opts.ordered = true
+	}
+}
+
+// WithClock lets the time based operators use the given clock.
+func WithClock(clock Clock) Option {
+	return func(opts *rxOptions) {
+		opts.clock = clock
+	}
+}
+
+// WithBuffer lets the caller customize how many items each output of
+// Partition and Tee buffers before blocking the source.
+func WithBuffer(size int) Option {
+	return func(opts *rxOptions) {
+		if size < 0 {
+			opts.buffer = 0
+		} else {
+			opts.buffer = size
+		}
+	}
+}
+
+// WithMemoryLimit lets the caller customize how many encoded bytes
+// ExternalSort keeps in memory before spilling a sorted run to disk.
+func WithMemoryLimit(limit int) Option {
+	return func(opts *rxOptions) {
+		opts.memoryLimit = limit
+	}
+}
+
+// WithTempDir lets the caller customize the directory that ExternalSort spills into.
+func WithTempDir(dir string) Option {
+	return func(opts *rxOptions) {
+		opts.tempDir = dir
+	}
+}
+
+// WithName lets the caller customize the name of the stage reported to the Observer.
+func WithName(name string) Option {
+	return func(opts *rxOptions) {
+		opts.name = name
+	}
+}
+
+// withName 设置默认的阶段名称，调用方传入的 WithName 优先
+func withName(name string, opts []Option) []Option {
+	return append([]Option{WithName(name)}, opts...)
+}
+
 // WithWorkers lets the caller customize the concurrent workers.
 func WithWorkers(workers int) Option {
 	return func(opts *rxOptions) {
@@ -40,6 +100,9 @@ func buildOptions(opts ...Option) *rxOptions {
 // newOptions returns a default rxOptions.
 func newOptions() *rxOptions {
 	return &rxOptions{
-		workers: defaultWorkers,
+		workers:     defaultWorkers,
+		clock:       RealClock(),
+		buffer:      defaultBuffer,
+		memoryLimit: defaultMemoryLimit,
 	}
 }
@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pedrogao/plib/pkg/common"
+)
+
+type (
+	// pipeline 由同一个源头派生出的所有 Stream 共享，
+	// 记录第一个错误，并在出错时取消所有阶段
+	pipeline struct {
+		parent context.Context
+		ctx    context.Context
+		cancel context.CancelFunc
+		err    common.AtomicError
+		// observer 只对设置之后创建的阶段生效
+		observer *Observer
+	}
+
+	// stage 是一个会向下游写数据的阶段，stop 之后不再向下游写数据，
+	// 同时停止上游，并排空自己的输出，保证写协程不会被阻塞
+	stage struct {
+		p        *pipeline
+		inputs   []*pipeline // 合并进 p 的其他流水线
+		quit     chan common.PlaceholderType
+		finished chan common.PlaceholderType
+		stopOnce sync.Once
+		upstream []func()
+		closeOut func()
+		drainOut func()
+		metrics  *stageMetrics
+	}
+)
+
+func newPipeline(parent context.Context) *pipeline {
+	ctx, cancel := context.WithCancel(parent)
+	return &pipeline{
+		parent: parent,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// fail records the first error and cancels all stages
+func (p *pipeline) fail(err error) {
+	p.err.Set(err)
+	p.cancel()
+}
+
+func (p *pipeline) error() error {
+	if err := p.err.Load(); err != nil {
+		return err
+	}
+	return p.parent.Err()
+}
+
+// absorb records the error of in if it has been cancelled
+func (p *pipeline) absorb(in *pipeline) {
+	select {
+	case <-in.ctx.Done():
+		if err := in.error(); err != nil {
+			p.fail(err)
+		}
+	default:
+	}
+}
+
+// newStage creates a stage writing to out, upstream stops the stages it reads from,
+// name is the name reported to the observer of p.
+func newStage[R Item](p *pipeline, name string, out chan R, upstream ...func()) *stage {
+	st := &stage{
+		p:        p,
+		quit:     make(chan common.PlaceholderType),
+		finished: make(chan common.PlaceholderType),
+		upstream: upstream,
+		closeOut: func() {
+			close(out)
+		},
+		drainOut: func() {
+			go drain(out)
+		},
+	}
+	if p.observer != nil {
+		st.metrics = p.observer.register(name, func() int {
+			return len(out)
+		})
+	}
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			st.stop()
+		case <-st.finished:
+		}
+	}()
+	return st
+}
+
+func (st *stage) stop() {
+	st.stopOnce.Do(func() {
+		close(st.quit)
+		for _, fn := range st.upstream {
+			fn()
+		}
+		st.drainOut()
+	})
+}
+
+// follow 让合并多个流的阶段跟随其他输入的流水线，任意一个输入出错或被取消时，
+// 错误记录到 st 所在的流水线并取消它
+func (st *stage) follow(inputs ...*pipeline) {
+	for _, in := range inputs {
+		if in == st.p {
+			continue
+		}
+		st.inputs = append(st.inputs, in)
+		in := in
+		go func() {
+			select {
+			case <-in.ctx.Done():
+				st.p.absorb(in)
+			case <-st.finished:
+			}
+		}()
+	}
+}
+
+// stopped returns whether the stage has been stopped
+func (st *stage) stopped() bool {
+	select {
+	case <-st.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// finish closes the output, must be called once by the goroutine writing to it
+func (st *stage) finish() {
+	// 输入的流水线出错后它的输出会正常结束，关闭输出之前同步一次错误，
+	// 保证读完输出之后 Err 能看到
+	for _, in := range st.inputs {
+		st.p.absorb(in)
+	}
+	st.closeOut()
+	close(st.finished)
+}
+
+// send writes item to out, returns false if the stage has been stopped
+func send[R Item](st *stage, out chan<- R, item R) bool {
+	select {
+	case out <- item:
+		return true
+	case <-st.quit:
+		return false
+	}
+}
+
+// derive returns the stream reading from the output of st
+func derive[T, R Item](s Stream[T], out <-chan R, st *stage) Stream[R] {
+	return Stream[R]{
+		source: relay(st, out),
+		p:      s.p,
+		stop:   st.stop,
+	}
+}
+
+// relay 在有 observer 时转发阶段的输出，统计输出的元素、积压和阻塞的时间
+func relay[R Item](st *stage, out <-chan R) <-chan R {
+	if st.metrics == nil {
+		return out
+	}
+
+	next := make(chan R)
+	go func() {
+		defer close(next)
+		for item := range out {
+			backlog := len(out)
+			start := time.Now()
+			if !send(st, next, item) {
+				drain(out)
+				return
+			}
+			st.metrics.emit(backlog, time.Since(start))
+		}
+	}()
+	return next
+}
+
+// timed 在有 observer 时记录 fn 处理每个元素的时间
+func timed[T, R Item](st *stage, fn WalkFunc[T, R]) WalkFunc[T, R] {
+	if st.metrics == nil {
+		return fn
+	}
+
+	return func(item T, pip chan<- R) {
+		start := time.Now()
+		defer func() {
+			st.metrics.process(start, time.Now())
+		}()
+		fn(item, pip)
+	}
+}
+
+func (st *stage) setWorkers(workers int) {
+	if st.metrics != nil {
+		atomic.StoreInt64(&st.metrics.workers, int64(workers))
+	}
+}
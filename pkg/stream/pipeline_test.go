@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+var errDummy = errors.New("dummy")
+
+// naturals 生成无限的自然数，直到 ctx 被取消
+func naturals(ctx context.Context, source chan<- int) {
+	for i := 0; ; i++ {
+		select {
+		case source <- i:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func TestStream_HeadStopsUpstream(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	items := Collect(FromContext(context.Background(), naturals).
+		Map(func(item int) int {
+			return item * 2
+		}, WithWorkers(4)).
+		Head(3))
+	assert.Equal(t, 3, len(items))
+}
+
+func TestStream_AnyMatchStopsUpstream(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ok := FromContext(context.Background(), naturals).
+		Filter(func(item int) bool {
+			return item%2 == 0
+		}, Ordered()).
+		AnyMatch(func(item int) bool {
+			return item > 100
+		})
+	assert.True(t, ok)
+}
+
+func TestStream_MapE(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := FromContext(context.Background(), naturals).
+		MapE(func(item int) (int, error) {
+			if item == 50 {
+				return 0, errDummy
+			}
+			return item, nil
+		}).
+		Filter(func(item int) bool {
+			return item%2 == 0
+		})
+	count := s.Count()
+	assert.True(t, count <= 50)
+	assert.Equal(t, errDummy, s.Err())
+}
+
+func TestStream_FilterE(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := Just(1, 2, 3, 4).FilterE(func(item int) (bool, error) {
+		return item%2 == 0, nil
+	})
+	assert.Equal(t, 2, s.Count())
+	assert.Nil(t, s.Err())
+
+	s = Just(1, 2, 3, 4).FilterE(func(item int) (bool, error) {
+		return false, errDummy
+	}).Sort(func(a, b int) bool {
+		return a < b
+	})
+	assert.Equal(t, 0, s.Count())
+	assert.Equal(t, errDummy, s.Err())
+}
+
+func TestStream_ConcatError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	failed := Just(6, 7, 8).MapE(func(item int) (int, error) {
+		return 0, errDummy
+	})
+	s := FromContext(context.Background(), naturals).Concat(failed)
+	s.Done()
+	assert.Equal(t, errDummy, s.Err())
+}
+
+func TestStream_FromContextCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := FromContext(ctx, naturals).Walk(func(item int, pip chan<- int) {
+		if item == 10 {
+			cancel()
+		}
+		pip <- item
+	}, UnlimitedWorkers())
+	s.Done()
+	assert.Equal(t, context.Canceled, s.Err())
+}
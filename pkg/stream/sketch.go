@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"github.com/pedrogao/plib/pkg/collection"
+)
+
+const (
+	// defaultQuantileSize Percentile 每一层保存的值的个数
+	defaultQuantileSize = 256
+	// topKFactor TopK 记录 k 的倍数个 key，提高估计的准确度
+	topKFactor = 10
+)
+
+// DistinctApprox is like Distinct, but keeps the keys in a bloom filter sized for numItems
+// keys with the false positive probability, so the memory is bounded. A false positive
+// drops an item that has not been seen before.
+func (s Stream[T]) DistinctApprox(keyFunc KeyFunc[T, string], numItems int, falsePositive float64) Stream[T] {
+	source := make(chan T)
+	st := newStage(s.p, "DistinctApprox", source, s.stop)
+	go func() {
+		defer st.finish()
+		filter := collection.NewBloomFilter(numItems, falsePositive)
+		for item := range s.source {
+			key := keyFunc(item)
+			if filter.Check(key) {
+				continue
+			}
+			filter.Add(key)
+			if !send(st, source, item) {
+				return
+			}
+		}
+	}()
+	return derive(s, source, st)
+}
+
+// CountDistinct estimates the number of distinct keys of s with HyperLogLog,
+// the standard error is about 1.04/sqrt(2^precision), precision is in [4, 16].
+func CountDistinct[T Item](s Stream[T], keyFunc KeyFunc[T, string], precision uint8) uint64 {
+	h := collection.NewHyperLogLog(precision)
+	for item := range s.source {
+		h.Add(keyFunc(item))
+	}
+	return h.Count()
+}
+
+// Percentile estimates the percentiles of the values of s, each of ps is in [0, 100],
+// the result is NaN if s is empty.
+func Percentile[T Item](s Stream[T], valueFunc func(item T) float64, ps ...float64) []float64 {
+	sketch := collection.NewQuantileSketch(defaultQuantileSize)
+	for item := range s.source {
+		sketch.Add(valueFunc(item))
+	}
+
+	results := make([]float64, len(ps))
+	for i, p := range ps {
+		results[i] = sketch.Quantile(p / 100)
+	}
+	return results
+}
+
+// TopK estimates the k most frequent keys of s in descending order of count.
+func TopK[T Item](s Stream[T], keyFunc KeyFunc[T, string], k int) []collection.TopKItem {
+	topK := collection.NewTopK(k * topKFactor)
+	for item := range s.source {
+		topK.Add(keyFunc(item))
+	}
+	return topK.Top(k)
+}
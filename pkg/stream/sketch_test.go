@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestDistinctApprox(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var items []int
+	for i := 0; i < 1000; i++ {
+		items = append(items, i%100)
+	}
+	distinct := Collect(Just(items...).DistinctApprox(func(item int) string {
+		return strconv.Itoa(item)
+	}, 100, 0.001))
+	// 误判只会丢弃元素，不会重复
+	assert.LessOrEqual(t, len(distinct), 100)
+	assert.GreaterOrEqual(t, len(distinct), 95)
+	seen := make(map[int]bool)
+	for _, item := range distinct {
+		assert.False(t, seen[item])
+		seen[item] = true
+	}
+
+	head := Collect(FromContext(context.Background(), naturals).DistinctApprox(func(item int) string {
+		return strconv.Itoa(item % 3)
+	}, 10, 0.01).Head(3))
+	assert.Equal(t, []int{0, 1, 2}, head)
+}
+
+func TestCountDistinct(t *testing.T) {
+	var items []int
+	for i := 0; i < 50000; i++ {
+		items = append(items, rand.Intn(10000))
+	}
+	count := CountDistinct(Just(items...), func(item int) string {
+		return strconv.Itoa(item)
+	}, 14)
+	seen := make(map[int]bool)
+	for _, item := range items {
+		seen[item] = true
+	}
+	assert.InEpsilon(t, len(seen), count, 0.03)
+}
+
+func TestPercentile(t *testing.T) {
+	ps := Percentile(Just(rand.Perm(10001)...), func(item int) float64 {
+		return float64(item)
+	}, 0, 50, 99, 100)
+	assert.InDelta(t, 0, ps[0], 200)
+	assert.InDelta(t, 5000, ps[1], 200)
+	assert.InDelta(t, 9900, ps[2], 200)
+	assert.InDelta(t, 10000, ps[3], 200)
+
+	ps = Percentile(Just[int](), func(item int) float64 {
+		return float64(item)
+	}, 50)
+	assert.True(t, math.IsNaN(ps[0]))
+}
+
+func TestTopK(t *testing.T) {
+	var words []string
+	for i := 0; i < 2000; i++ {
+		words = append(words, "a", strconv.Itoa(i))
+		if i%2 == 0 {
+			words = append(words, "b")
+		}
+	}
+	rand.Shuffle(len(words), func(i, j int) {
+		words[i], words[j] = words[j], words[i]
+	})
+	top := TopK(Just(words...), func(item string) string {
+		return item
+	}, 2)
+	assert.Len(t, top, 2)
+	assert.Equal(t, "a", top[0].Key)
+	assert.Equal(t, "b", top[1].Key)
+	assert.GreaterOrEqual(t, top[0].Count, 2000)
+	assert.LessOrEqual(t, top[0].Count-top[0].Error, 2000)
+}
@@ -0,0 +1,279 @@
+package stream
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type (
+	// Codec encodes the items that ExternalSort spills to disk.
+	Codec[T Item] interface {
+		Marshal(item T) ([]byte, error)
+		Unmarshal(data []byte) (T, error)
+	}
+
+	jsonCodec[T Item] struct{}
+
+	// sortRecord 保留编码后的数据，溢出时不用再次编码
+	sortRecord[T Item] struct {
+		item T
+		data []byte
+	}
+
+	sorter[T Item] struct {
+		less    LessFunc[T]
+		codec   Codec[T]
+		limit   int
+		tempDir string
+		dir     string
+		records []sortRecord[T]
+		size    int
+		runs    []string
+	}
+
+	sortSource[T Item] interface {
+		next() (T, bool, error)
+	}
+
+	sortRunReader[T Item] struct {
+		reader *bufio.Reader
+		codec  Codec[T]
+	}
+
+	sortSliceReader[T Item] struct {
+		records []sortRecord[T]
+	}
+
+	sortItem[T Item] struct {
+		item   T
+		source int
+	}
+
+	sortHeap[T Item] struct {
+		items []sortItem[T]
+		less  LessFunc[T]
+	}
+)
+
+// JSONCodec returns a Codec that encodes items as json.
+func JSONCodec[T Item]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Marshal(item T) ([]byte, error) {
+	return jsoniter.Marshal(item)
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte) (T, error) {
+	var item T
+	err := jsoniter.Unmarshal(data, &item)
+	return item, err
+}
+
+// ExternalSort sorts s like Sort, but once the encoded items exceed the memory limit,
+// they are sorted and spilled to a temp file as a run, the runs are merged back at last.
+// The sort is stable. Use WithMemoryLimit and WithTempDir to customize the spilling.
+func ExternalSort[T Item](s Stream[T], less LessFunc[T], codec Codec[T], opts ...Option) Stream[T] {
+	option := buildOptions(opts...)
+	srt := &sorter[T]{
+		less:    less,
+		codec:   codec,
+		limit:   option.memoryLimit,
+		tempDir: option.tempDir,
+	}
+
+	source := make(chan T)
+	st := newStage(s.p, "ExternalSort", source, s.stop)
+	go func() {
+		defer st.finish()
+		defer srt.clean()
+		if err := srt.run(s, st, source); err != nil {
+			s.abort(err)
+		}
+	}()
+	return derive(s, source, st)
+}
+
+func (srt *sorter[T]) run(s Stream[T], st *stage, out chan<- T) error {
+	for item := range s.source {
+		data, err := srt.codec.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("marshal item err: %s", err)
+		}
+		srt.records = append(srt.records, sortRecord[T]{item: item, data: data})
+		srt.size += len(data)
+		if srt.size < srt.limit {
+			continue
+		}
+		if err = srt.spill(); err != nil {
+			return err
+		}
+	}
+
+	return srt.merge(func(item T) bool {
+		return send(st, out, item)
+	})
+}
+
+func (srt *sorter[T]) sort() {
+	sort.SliceStable(srt.records, func(i, j int) bool {
+		return srt.less(srt.records[i].item, srt.records[j].item)
+	})
+}
+
+// spill 将排序后的记录写入一个新的 run 文件
+func (srt *sorter[T]) spill() error {
+	if srt.dir == "" {
+		dir, err := os.MkdirTemp(srt.tempDir, "stream-sort")
+		if err != nil {
+			return fmt.Errorf("create sort dir err: %s", err)
+		}
+		srt.dir = dir
+	}
+
+	srt.sort()
+	path := filepath.Join(srt.dir, fmt.Sprintf("run%05d", len(srt.runs)))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create run file err: %s", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, r := range srt.records {
+		n := binary.PutUvarint(buf, uint64(len(r.data)))
+		if _, err = writer.Write(buf[:n]); err != nil {
+			return fmt.Errorf("write run file err: %s", err)
+		}
+		if _, err = writer.Write(r.data); err != nil {
+			return fmt.Errorf("write run file err: %s", err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("flush run file err: %s", err)
+	}
+
+	srt.runs = append(srt.runs, path)
+	srt.records = nil
+	srt.size = 0
+	return nil
+}
+
+// merge k 路归并所有 run 和内存中的记录，emit 返回 false 时停止
+func (srt *sorter[T]) merge(emit func(item T) bool) error {
+	srt.sort()
+
+	sources := make([]sortSource[T], 0, len(srt.runs)+1)
+	for _, path := range srt.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open run file err: %s", err)
+		}
+		defer file.Close()
+		sources = append(sources, &sortRunReader[T]{reader: bufio.NewReader(file), codec: srt.codec})
+	}
+	sources = append(sources, &sortSliceReader[T]{records: srt.records})
+
+	h := &sortHeap[T]{less: srt.less}
+	for i, source := range sources {
+		if err := h.pushNext(source, i); err != nil {
+			return err
+		}
+	}
+	for h.Len() > 0 {
+		item := heap.Pop(h).(sortItem[T])
+		if !emit(item.item) {
+			return nil
+		}
+		if err := h.pushNext(sources[item.source], item.source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (srt *sorter[T]) clean() {
+	if srt.dir != "" {
+		_ = os.RemoveAll(srt.dir)
+	}
+}
+
+func (r *sortRunReader[T]) next() (T, bool, error) {
+	var item T
+	n, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return item, false, nil
+	} else if err != nil {
+		return item, false, fmt.Errorf("read run file err: %s", err)
+	}
+	data := make([]byte, n)
+	if _, err = io.ReadFull(r.reader, data); err != nil {
+		return item, false, fmt.Errorf("read run file err: %s", err)
+	}
+	if item, err = r.codec.Unmarshal(data); err != nil {
+		return item, false, fmt.Errorf("unmarshal item err: %s", err)
+	}
+	return item, true, nil
+}
+
+func (r *sortSliceReader[T]) next() (T, bool, error) {
+	if len(r.records) == 0 {
+		var item T
+		return item, false, nil
+	}
+	item := r.records[0].item
+	r.records = r.records[1:]
+	return item, true, nil
+}
+
+func (h *sortHeap[T]) pushNext(source sortSource[T], i int) error {
+	item, ok, err := source.next()
+	if err != nil {
+		return err
+	}
+	if ok {
+		heap.Push(h, sortItem[T]{item: item, source: i})
+	}
+	return nil
+}
+
+func (h *sortHeap[T]) Len() int {
+	return len(h.items)
+}
+
+func (h *sortHeap[T]) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.item, b.item) {
+		return true
+	}
+	if h.less(b.item, a.item) {
+		return false
+	}
+	// 相等时先写入的 run 排在前面，保证排序稳定
+	return a.source < b.source
+}
+
+func (h *sortHeap[T]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *sortHeap[T]) Push(x any) {
+	h.items = append(h.items, x.(sortItem[T]))
+}
+
+func (h *sortHeap[T]) Pop() any {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	h.items = old[:n-1]
+	return item
+}
@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type (
+	sortEntry struct {
+		Key   int
+		Value int
+	}
+
+	failCodec struct {
+		Codec[int]
+	}
+)
+
+func (failCodec) Marshal(int) ([]byte, error) {
+	return nil, errDummy
+}
+
+func TestExternalSort(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	items := rand.Perm(1000)
+	dir := t.TempDir()
+	sorted := Collect(ExternalSort(Just(items...), func(a, b int) bool {
+		return a < b
+	}, JSONCodec[int](), WithMemoryLimit(100), WithTempDir(dir)))
+	sort.Ints(items)
+	assert.Equal(t, items, sorted)
+
+	// 临时文件已清理
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExternalSortStable(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var entries []sortEntry
+	for i := 0; i < 200; i++ {
+		entries = append(entries, sortEntry{Key: rand.Intn(5), Value: i})
+	}
+	sorted := Collect(ExternalSort(Just(entries...), func(a, b sortEntry) bool {
+		return a.Key < b.Key
+	}, JSONCodec[sortEntry](), WithMemoryLimit(256), WithTempDir(t.TempDir())))
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	assert.Equal(t, entries, sorted)
+}
+
+func TestExternalSortInMemory(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// 没有超过内存预算时不会创建临时目录
+	dir := t.TempDir()
+	sorted := Collect(ExternalSort(Just(3, 1, 2), func(a, b int) bool {
+		return a > b
+	}, JSONCodec[int](), WithTempDir(dir)))
+	assert.Equal(t, []int{3, 2, 1}, sorted)
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExternalSortStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	sorted := Collect(ExternalSort(Just(rand.Perm(1000)...), func(a, b int) bool {
+		return a < b
+	}, JSONCodec[int](), WithMemoryLimit(100), WithTempDir(dir)).Head(3))
+	assert.Equal(t, []int{0, 1, 2}, sorted)
+
+	stream := ExternalSort(FromContext(context.Background(), naturals), func(a, b int) bool {
+		return a < b
+	}, Codec[int](failCodec{}))
+	assert.Empty(t, Collect(stream))
+	assert.ErrorContains(t, stream.Err(), errDummy.Error())
+}
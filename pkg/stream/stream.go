@@ -1,6 +1,9 @@
 package stream
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sort"
 	"sync"
 
@@ -12,17 +15,23 @@ import (
 const (
 	defaultWorkers = 16
 	minWorkers     = 1
+	defaultBuffer  = 16
+	// defaultMemoryLimit ExternalSort 默认的内存预算
+	defaultMemoryLimit = 64 << 20
 )
 
+// ErrKeyNotComparable is the error of Distinct when a key can not be used as a map key.
+var ErrKeyNotComparable = errors.New("distinct key is not comparable")
+
 type (
-	// Item of stream
-	Item interface {
-		comparable
-	}
+	// Item of stream, any type including slices and maps
+	Item interface{}
 
 	// Stream computing
 	Stream[T Item] struct {
-		source <-chan T // 只读 channel，不能写
+		source <-chan T  // 只读 channel，不能写
+		p      *pipeline // 同一条流水线上的 Stream 共享
+		stop   func()    // 停止产生 source 的阶段
 	}
 
 	// KeyFunc key生成器
@@ -51,28 +60,62 @@ type (
 	ForEachFunc[T Item] func(item T)
 
 	// GenerateFunc item生成函数
-	GenerateFunc[T Item] func(source <-chan T)
+	GenerateFunc[T Item] func(source chan<- T)
+
+	// GenerateContextFunc 可以感知取消的 item 生成函数
+	GenerateContextFunc[T Item] func(ctx context.Context, source chan<- T)
+
+	// WalkErrFunc 可以返回错误的遍历函数
+	WalkErrFunc[T Item, R Item] func(item T, pip chan<- R) error
+
+	// MapErrFunc 可以返回错误的对象转换函数
+	MapErrFunc[T Item, R Item] func(item T) (R, error)
+
+	// FilterErrFunc 可以返回错误的过滤函数
+	FilterErrFunc[T Item] func(item T) (bool, error)
 )
 
-// Distinct 去重，使用 map 来实现去重
+// Distinct 去重，使用 map 来实现去重。key 不可比较时（例如 slice）流被取消，
+// 错误可以通过 Err 读取，需要编译期检查 key 类型时使用包级函数 Distinct
 func (s Stream[T]) Distinct(keyFunc KeyFunc[T, T]) Stream[T] {
+	keys := make(map[any]common.PlaceholderType)
+	return distinct(s, func(item T) (added bool, err error) {
+		defer func() {
+			// 不可比较的 key 在 map 中查找时会 panic
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrKeyNotComparable, r)
+			}
+		}()
+		key := keyFunc(item)
+		if _, ok := keys[key]; ok {
+			return false, nil
+		}
+		keys[key] = common.Placeholder
+		return true, nil
+	})
+}
+
+// distinct 写出 add 返回 true 的元素，add 出错时取消整个流
+func distinct[T Item](s Stream[T], add func(item T) (bool, error)) Stream[T] {
 	source := make(chan T)
+	st := newStage(s.p, "Distinct", source, s.stop)
 	common.GoSafe(func() { // 新建协程写数据
 		// channel记得关闭是个好习惯
-		defer close(source)
-		keys := make(map[T]common.PlaceholderType)
+		defer st.finish()
 
 		for item := range s.source {
-			// 自定义去重逻辑
-			key := keyFunc(item) // 这里的key类型是R
 			// 如果key不存在,则将数据写入新的channel
-			if _, ok := keys[key]; !ok {
-				source <- item
-				keys[key] = common.Placeholder
+			added, err := add(item)
+			if err != nil {
+				s.p.fail(err)
+				return
+			}
+			if added && !send(st, source, item) {
+				return
 			}
 		}
 	})
-	return Range[T](source)
+	return derive(s, source, st)
 }
 
 func (s Stream[T]) Filter(filterFunc FilterFunc[T], opts ...Option) Stream[T] {
@@ -80,26 +123,101 @@ func (s Stream[T]) Filter(filterFunc FilterFunc[T], opts ...Option) Stream[T] {
 		if filterFunc(item) {
 			pip <- item
 		}
-	}, opts...)
+	}, withName("Filter", opts)...)
+}
+
+// FilterE is like Filter, but the first error returned by fn cancels the pipeline.
+func (s Stream[T]) FilterE(fn FilterErrFunc[T], opts ...Option) Stream[T] {
+	return s.WalkE(func(item T, pip chan<- T) error {
+		ok, err := fn(item)
+		if err != nil {
+			return err
+		}
+		if ok {
+			pip <- item
+		}
+		return nil
+	}, withName("Filter", opts)...)
 }
 
 func (s Stream[T]) Walk(fn WalkFunc[T, T], opts ...Option) Stream[T] {
+	return walk(s, fn, withName("Walk", opts)...)
+}
+
+// WalkE is like Walk, but the first error returned by fn cancels all stages of
+// the pipeline, the error can be read from Err once the stream is consumed.
+func (s Stream[T]) WalkE(fn WalkErrFunc[T, T], opts ...Option) Stream[T] {
+	return walk(s, func(item T, pip chan<- T) {
+		if err := fn(item, pip); err != nil {
+			s.p.fail(err)
+		}
+	}, withName("Walk", opts)...)
+}
+
+// walk 方法不能带额外的类型参数，所以 Walk 与 Map 等都基于这个函数实现
+func walk[T, R Item](s Stream[T], fn WalkFunc[T, R], opts ...Option) Stream[R] {
 	option := buildOptions(opts...)
+	if option.ordered {
+		return walkOrdered(s, fn, option)
+	}
 	if option.unlimitedWorkers {
-		return s.walkUnLimited(fn, option)
+		return walkUnLimited(s, fn, option)
 	}
-	return s.walkLimited(fn, option)
+	return walkLimited(s, fn, option)
+}
+
+func walkOrdered[T, R Item](s Stream[T], fn WalkFunc[T, R],
+	option *rxOptions) Stream[R] {
+	pipe := make(chan R, option.workers)
+	st := newStage(s.p, option.name, pipe, s.stop)
+	st.setWorkers(option.workers)
+	fn = timed(st, fn)
+	// 每个 item 的结果写入各自的 channel，这些 channel 按输入顺序排队，
+	// 队列的容量就是重排缓冲区的大小，写满后不再读取新的 item，保证内存有界
+	results := make(chan chan R, option.workers)
+	go func() {
+		defer close(results)
+		for item := range s.source {
+			if st.stopped() {
+				return
+			}
+			// 重要, 不赋值给val是个典型的并发陷阱，后面在另一个goroutine里使用了
+			val := item
+			result := make(chan R, 1)
+			results <- result
+			common.GoSafe(func() {
+				defer close(result)
+				fn(val, result)
+			})
+		}
+	}()
+	go func() {
+		defer st.finish()
+		// 按顺序输出，后面的 item 即使先完成也要等前面的输出完毕
+		// 停止之后依然需要读完所有结果，避免写结果的协程阻塞
+		for result := range results {
+			for item := range result {
+				send(st, pipe, item)
+			}
+		}
+	}()
+	return derive(s, pipe, st)
 }
 
-func (s Stream[T]) walkUnLimited(fn WalkFunc[T, T],
-	option *rxOptions) Stream[T] {
+func walkUnLimited[T, R Item](s Stream[T], fn WalkFunc[T, R],
+	option *rxOptions) Stream[R] {
 	// 创建带缓冲区的channel
 	// 默认为16,channel中元素超过16将会被阻塞
-	pipe := make(chan T, defaultWorkers)
+	pipe := make(chan R, defaultWorkers)
+	st := newStage(s.p, option.name, pipe, s.stop)
+	fn = timed(st, fn)
 	go func() {
 		var wg sync.WaitGroup
 
 		for item := range s.source {
+			if st.stopped() {
+				break
+			}
 			// 需要读取s.source的所有元素
 			// 这里也说明了为什么channel最后写完记得完毕
 			// 如果不关闭可能导致协程一直阻塞导致泄漏
@@ -113,22 +231,28 @@ func (s Stream[T]) walkUnLimited(fn WalkFunc[T, T],
 			})
 		}
 		wg.Wait()
-		close(pipe)
+		st.finish()
 	}()
 
 	// 返回新的Stream
-	return Range[T](pipe)
+	return derive(s, pipe, st)
 }
 
-func (s Stream[T]) walkLimited(fn WalkFunc[T, T],
-	option *rxOptions) Stream[T] {
-	pipe := make(chan T, option.workers)
+func walkLimited[T, R Item](s Stream[T], fn WalkFunc[T, R],
+	option *rxOptions) Stream[R] {
+	pipe := make(chan R, option.workers)
+	st := newStage(s.p, option.name, pipe, s.stop)
+	st.setWorkers(option.workers)
+	fn = timed(st, fn)
 	go func() {
 		var wg sync.WaitGroup
 		// 控制协程数量
 		pool := make(chan common.PlaceholderType, option.workers)
 
 		for item := range s.source {
+			if st.stopped() {
+				break
+			}
 			// 重要, 不赋值给val是个典型的并发陷阱，后面在另一个goroutine里使用了
 			val := item
 			// 超过协程限制时将会被阻塞
@@ -148,9 +272,9 @@ func (s Stream[T]) walkLimited(fn WalkFunc[T, T],
 			})
 		}
 		wg.Wait()
-		close(pipe)
+		st.finish()
 	}()
-	return Range[T](pipe)
+	return derive(s, pipe, st)
 }
 
 func (s Stream[T]) Head(n int64) Stream[T] {
@@ -158,32 +282,26 @@ func (s Stream[T]) Head(n int64) Stream[T] {
 		panic("n must be greater than 1")
 	}
 	source := make(chan T)
+	st := newStage(s.p, "Head", source, s.stop)
 	go func() {
+		// 循环跳出来了说明n大于s.source实际长度，或者已经拿够了n个元素
+		// 都需要显示关闭新的source
+		defer st.finish()
 		for item := range s.source {
-			n--
-			// n值可能大于s.source长度,需要判断是否>=0
-			if n >= 0 {
-				source <- item
+			if !send(st, source, item) {
+				return
 			}
-			// let successive method go ASAP even we have more items to skip
-			// why we don't just break the loop, because if break,
-			// this former goroutine will block forever, which will cause goroutine leak.
+			n--
 			// n==0说明source已经写满可以进行关闭了
-			// 既然source已经满足条件了为什么不直接进行break跳出循环呢?
-			// 作者提到了防止协程泄漏
-			// 因为每次操作最终都会产生一个新的Stream,旧的Stream永远也不会被调用了
+			// 直接跳出循环会导致上游的协程阻塞，所以需要停止上游，
+			// 上游的阶段会排空自己的输出并退出，而不是一直运行下去
 			if n == 0 {
-				close(source)
-				break
+				s.stop()
+				return
 			}
 		}
-		// 上面的循环跳出来了说明n大于s.source实际长度
-		// 依旧需要显示关闭新的source
-		if n > 0 {
-			close(source)
-		}
 	}()
-	return Range[T](source)
+	return derive(s, source, st)
 }
 
 func (s Stream[T]) Tail(n int64) Stream[T] {
@@ -191,7 +309,9 @@ func (s Stream[T]) Tail(n int64) Stream[T] {
 		panic("n must be greater than 1")
 	}
 	source := make(chan T)
+	st := newStage(s.p, "Tail", source, s.stop)
 	go func() {
+		defer st.finish()
 		ring := collection.NewRing[T](int(n))
 		// 读取全部元素，如果数量>n环形切片能实现新数据覆盖旧数据
 		// 保证获取到的一定最后n个元素
@@ -199,17 +319,30 @@ func (s Stream[T]) Tail(n int64) Stream[T] {
 			ring.Add(item)
 		}
 		for _, item := range ring.Take() {
-			source <- item
+			if !send(st, source, item) {
+				return
+			}
 		}
-		close(source)
 	}()
-	return Range[T](source)
+	return derive(s, source, st)
 }
 
 func (s Stream[T]) Map(fn MapFunc[T, T], opts ...Option) Stream[T] {
 	return s.Walk(func(item T, pip chan<- T) {
 		pip <- fn(item)
-	}, opts...)
+	}, withName("Map", opts)...)
+}
+
+// MapE is like Map, but the first error returned by fn cancels the pipeline.
+func (s Stream[T]) MapE(fn MapErrFunc[T, T], opts ...Option) Stream[T] {
+	return s.WalkE(func(item T, pip chan<- T) error {
+		v, err := fn(item)
+		if err != nil {
+			return err
+		}
+		pip <- v
+		return nil
+	}, withName("Map", opts)...)
 }
 
 func (s Stream[T]) Reverse() Stream[T] {
@@ -221,7 +354,7 @@ func (s Stream[T]) Reverse() Stream[T] {
 		opp := len(items) - 1 - i
 		items[i], items[opp] = items[opp], items[i]
 	}
-	return Just[T](items...)
+	return s.just(items)
 }
 
 func (s Stream[T]) Sort(fn LessFunc[T]) Stream[T] {
@@ -233,14 +366,14 @@ func (s Stream[T]) Sort(fn LessFunc[T]) Stream[T] {
 	sort.Slice(items, func(i, j int) bool {
 		return fn(items[i], items[j])
 	})
-	return Just[T](items...)
+	return s.just(items)
 }
 
 func (s Stream[T]) AllMatch(fn PredicateFunc[T]) bool {
 	for item := range s.source {
 		if !fn(item) {
-			// 需要排空 s.source，否则前面的goroutine可能阻塞
-			go drain(s.source)
+			// 需要停止上游，否则前面的goroutine可能阻塞
+			s.stop()
 			return false
 		}
 	}
@@ -251,8 +384,8 @@ func (s Stream[T]) AllMatch(fn PredicateFunc[T]) bool {
 func (s Stream[T]) AnyMatch(fn PredicateFunc[T]) bool {
 	for item := range s.source {
 		if fn(item) {
-			// 需要排空 s.source，否则前面的goroutine可能阻塞
-			go drain(s.source)
+			// 需要停止上游，否则前面的goroutine可能阻塞
+			s.stop()
 			return true
 		}
 	}
@@ -263,8 +396,8 @@ func (s Stream[T]) AnyMatch(fn PredicateFunc[T]) bool {
 func (s Stream[T]) NoneMatch(fn func(item T) bool) bool {
 	for item := range s.source {
 		if fn(item) {
-			// 需要排空 s.source，否则前面的goroutine可能阻塞
-			go drain(s.source)
+			// 需要停止上游，否则前面的goroutine可能阻塞
+			s.stop()
 			return false
 		}
 	}
@@ -295,13 +428,34 @@ func (s Stream[T]) ForEach(fn ForEachFunc[T]) {
 	}
 }
 
+// Err returns the first error of the pipeline, or the error of the
+// context passed to FromContext, call it after the stream is consumed.
+func (s Stream[T]) Err() error {
+	return s.p.error()
+}
+
 func (s Stream[T]) channel() <-chan T {
 	return s.source
 }
 
+// just returns a stream of items on the same pipeline as s
+func (s Stream[T]) just(items []T) Stream[T] {
+	stream := Just(items...)
+	stream.p = s.p
+	return stream
+}
+
 func Range[T Item](source <-chan T) Stream[T] {
+	var once sync.Once
 	return Stream[T]{
 		source: source,
+		p:      newPipeline(context.Background()),
+		stop: func() {
+			// source 不是流水线创建的，只能排空
+			once.Do(func() {
+				go drain(source)
+			})
+		},
 	}
 }
 
@@ -315,41 +469,83 @@ func Just[T Item](items ...T) Stream[T] {
 }
 
 func From[T Item](generate GenerateFunc[T]) Stream[T] {
+	return FromContext(context.Background(), func(_ context.Context, source chan<- T) {
+		generate(source)
+	})
+}
+
+// FromContext creates a stream whose pipeline is cancelled with ctx, generate receives
+// a context that is done once the pipeline is cancelled or the stream is stopped.
+func FromContext[T Item](ctx context.Context, generate GenerateContextFunc[T]) Stream[T] {
+	return fromContextE(ctx, func(ctx context.Context, source chan<- T) error {
+		generate(ctx, source)
+		return nil
+	})
+}
+
+// fromContextE is like FromContext, the error returned by generate cancels the pipeline.
+func fromContextE[T Item](ctx context.Context, generate func(ctx context.Context, source chan<- T) error) Stream[T] {
+	p := newPipeline(ctx)
+	genCtx, cancel := context.WithCancel(p.ctx)
 	source := make(chan T)
+	st := newStage(p, "From", source, cancel)
 	common.GoSafe(func() {
-		defer close(source)
-		generate(source)
+		defer func() {
+			cancel()
+			st.finish()
+		}()
+		if err := generate(genCtx, source); err != nil {
+			p.fail(err)
+		}
 	})
-	return Range[T](source)
+	return Stream[T]{
+		source: source,
+		p:      p,
+		stop:   st.stop,
+	}
 }
 
 func (s Stream[T]) Concat(steams ...Stream[T]) Stream[T] {
 	// 创建新的无缓冲channel
 	source := make(chan T)
+	upstream := []func(){s.stop}
+	inputs := make([]*pipeline, 0, len(steams))
+	for _, stream := range steams {
+		upstream = append(upstream, stream.stop)
+		inputs = append(inputs, stream.p)
+	}
+	st := newStage(s.p, "Concat", source, upstream...)
+	// 拼接的流出错时同样取消整个流
+	st.follow(inputs...)
 	go func() {
 		// 创建一个waiGroup对象
 		group := task.NewRoutineGroup()
 		// 异步从原channel读取数据
 		group.Run(func() {
 			for item := range s.source {
-				source <- item
+				if !send(st, source, item) {
+					return
+				}
 			}
 		})
 		// 异步读取待拼接Stream的channel数据
 		for _, stream := range steams {
+			stream := stream
 			// 每个Stream开启一个协程
 			group.Run(func() {
 				for item := range stream.channel() {
-					source <- item
+					if !send(st, source, item) {
+						return
+					}
 				}
 			})
 		}
 		// 阻塞等待读取完成
 		group.Wait()
-		close(source)
+		st.finish()
 	}()
 	// 返回新的Stream
-	return Range[T](source)
+	return derive(s, source, st)
 }
 
 // drain drains the given channel.
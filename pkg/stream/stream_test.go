@@ -1,7 +1,11 @@
 package stream
 
 import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +30,21 @@ func TestStream_Distinct(t *testing.T) {
 	})
 }
 
+func TestDistinct(t *testing.T) {
+	words := Just("a", "bb", "c", "dd", "eee")
+	assert.Equal(t, []string{"a", "bb", "eee"}, Collect(Distinct(words, func(item string) int {
+		return len(item)
+	})))
+}
+
+func TestStream_DistinctNotComparable(t *testing.T) {
+	s := Just([]int{1}, []int{1}, []int{2}).Distinct(func(item []int) []int {
+		return item
+	})
+	assert.Empty(t, Collect(s))
+	assert.True(t, errors.Is(s.Err(), ErrKeyNotComparable))
+}
+
 func TestStream_Filter(t *testing.T) {
 	// 保留偶数 2,4
 	channel := Just(1, 2, 3, 4, 5).Filter(func(item int) bool {
@@ -120,3 +139,32 @@ func TestStream_AllMatch(t *testing.T) {
 		})
 	assert.False(ok)
 }
+
+func TestStream_Ordered(t *testing.T) {
+	var items []int
+	for i := 0; i < 100; i++ {
+		items = append(items, i)
+	}
+
+	var running, maxRunning int32
+	result := Collect(Map(Just(items...), func(item int) int {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		return item * 10
+	}, Ordered(), WithWorkers(4)))
+
+	assert.Equal(t, 100, len(result))
+	for i, item := range result {
+		assert.Equal(t, i*10, item)
+	}
+	// 重排缓冲区有界：正在执行的 item 不会超过 workers + 2
+	assert.True(t, atomic.LoadInt32(&maxRunning) > 1)
+	assert.True(t, atomic.LoadInt32(&maxRunning) <= 6)
+}
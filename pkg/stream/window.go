@@ -0,0 +1,173 @@
+package stream
+
+import "time"
+
+// Window is the items a stream received in the time window (End-Size, End].
+type Window[T Item] struct {
+	Start time.Time
+	End   time.Time
+	Items []T
+}
+
+// Buffer groups every n items into a slice, the last slice may have less than n items.
+func Buffer[T Item](s Stream[T], n int) Stream[[]T] {
+	if n < 1 {
+		panic("n must be greater than 0")
+	}
+	source := make(chan []T)
+	st := newStage(s.p, "Buffer", source, s.stop)
+	go func() {
+		defer st.finish()
+		var items []T
+		for item := range s.source {
+			items = append(items, item)
+			if len(items) < n {
+				continue
+			}
+			if !send(st, source, items) {
+				return
+			}
+			items = nil
+		}
+		if len(items) > 0 {
+			send(st, source, items)
+		}
+	}()
+	return derive(s, source, st)
+}
+
+// BufferTime groups the items received in every d into a slice, empty slices are skipped.
+func BufferTime[T Item](s Stream[T], d time.Duration, opts ...Option) Stream[[]T] {
+	return window(s, d, d, func(w Window[T]) ([]T, bool) {
+		return w.Items, len(w.Items) > 0
+	}, opts...)
+}
+
+// TumblingWindow emits a window every d with the items received in it, including empty windows.
+func TumblingWindow[T Item](s Stream[T], d time.Duration, opts ...Option) Stream[Window[T]] {
+	return SlidingWindow(s, d, d, opts...)
+}
+
+// SlidingWindow emits a window of the items received in the last size every slide,
+// size must be a multiple of slide, so an item shows up in size/slide windows.
+func SlidingWindow[T Item](s Stream[T], size, slide time.Duration, opts ...Option) Stream[Window[T]] {
+	return window(s, size, slide, func(w Window[T]) (Window[T], bool) {
+		return w, true
+	}, opts...)
+}
+
+// window 将时间切分为长度为 slide 的 pane，每个窗口由最近 size/slide 个 pane 组成，
+// fn 返回 false 时不输出该窗口
+func window[T, R Item](s Stream[T], size, slide time.Duration,
+	fn func(w Window[T]) (R, bool), opts ...Option) Stream[R] {
+	if slide <= 0 || size < slide || size%slide != 0 {
+		panic("size must be a positive multiple of slide")
+	}
+	clock := buildOptions(opts...).clock
+	source := make(chan R)
+	st := newStage(s.p, "Window", source, s.stop)
+	end := clock.Now().Add(slide)
+	ticker := clock.NewTicker(slide)
+	go func() {
+		defer st.finish()
+		defer ticker.Stop()
+		panes := make([][]T, size/slide)
+		last := len(panes) - 1
+		emit := func() bool {
+			var items []T
+			for _, pane := range panes {
+				items = append(items, pane...)
+			}
+			r, ok := fn(Window[T]{Start: end.Add(-size), End: end, Items: items})
+			if ok && !send(st, source, r) {
+				return false
+			}
+			copy(panes, panes[1:])
+			panes[last] = nil
+			return true
+		}
+
+		for {
+			select {
+			case item, ok := <-s.source:
+				if !ok {
+					// 输出最后一个未到期的窗口
+					if len(panes[last]) > 0 {
+						emit()
+					}
+					return
+				}
+				panes[last] = append(panes[last], item)
+			case <-ticker.C():
+				if !emit() {
+					return
+				}
+				end = end.Add(slide)
+			}
+		}
+	}()
+	return derive(s, source, st)
+}
+
+// Throttle emits an item and drops the following items received within d.
+func (s Stream[T]) Throttle(d time.Duration, opts ...Option) Stream[T] {
+	clock := buildOptions(opts...).clock
+	source := make(chan T)
+	st := newStage(s.p, "Throttle", source, s.stop)
+	go func() {
+		defer st.finish()
+		var last time.Time
+		emitted := false
+		for item := range s.source {
+			now := clock.Now()
+			if emitted && now.Sub(last) < d {
+				continue
+			}
+			if !send(st, source, item) {
+				return
+			}
+			last = now
+			emitted = true
+		}
+	}()
+	return derive(s, source, st)
+}
+
+// Debounce emits an item only if no other item is received within d after it,
+// the pending item is emitted when the stream ends.
+func (s Stream[T]) Debounce(d time.Duration, opts ...Option) Stream[T] {
+	clock := buildOptions(opts...).clock
+	source := make(chan T)
+	st := newStage(s.p, "Debounce", source, s.stop)
+	timer := clock.NewTimer(d)
+	timer.Stop()
+	go func() {
+		defer st.finish()
+		defer timer.Stop()
+		var pending T
+		hasPending := false
+		for {
+			select {
+			case item, ok := <-s.source:
+				if !ok {
+					if hasPending {
+						send(st, source, pending)
+					}
+					return
+				}
+				pending = item
+				hasPending = true
+				timer.Reset(d)
+			case <-timer.C():
+				if !hasPending {
+					continue
+				}
+				if !send(st, source, pending) {
+					return
+				}
+				hasPending = false
+			}
+		}
+	}()
+	return derive(s, source, st)
+}
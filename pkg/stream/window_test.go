@@ -0,0 +1,183 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+type (
+	// notifyClock 在读取时间和重置 timer 之后通知测试，测试据此确定元素已被处理
+	notifyClock struct {
+		*FakeClock
+		notify chan struct{}
+	}
+
+	notifyTimer struct {
+		Timer
+		notify chan struct{}
+	}
+)
+
+func newNotifyClock() notifyClock {
+	return notifyClock{
+		FakeClock: NewFakeClock(time.Unix(0, 0)),
+		notify:    make(chan struct{}),
+	}
+}
+
+func (c notifyClock) Now() time.Time {
+	now := c.FakeClock.Now()
+	c.notify <- struct{}{}
+	return now
+}
+
+func (c notifyClock) NewTimer(d time.Duration) Timer {
+	return notifyTimer{
+		Timer:  c.FakeClock.NewTimer(d),
+		notify: c.notify,
+	}
+}
+
+func (t notifyTimer) Reset(d time.Duration) {
+	t.Timer.Reset(d)
+	t.notify <- struct{}{}
+}
+
+func collectAsync[T Item](s Stream[T]) <-chan []T {
+	result := make(chan []T, 1)
+	go func() {
+		result <- Collect(s)
+	}()
+	return result
+}
+
+func TestBuffer(t *testing.T) {
+	items := Collect(Buffer(Just(1, 2, 3, 4, 5), 2))
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, items)
+	assert.Panics(t, func() {
+		Buffer(Just(1), 0)
+	})
+}
+
+func TestBufferTime(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	source := make(chan int)
+	result := collectAsync(BufferTime(Range(source), time.Second, WithClock(clock)))
+	source <- 1
+	source <- 2
+	clock.Advance(time.Second)
+	source <- 3
+	clock.Advance(time.Second)
+	// 空的窗口不输出
+	clock.Advance(time.Second)
+	source <- 4
+	close(source)
+	assert.Equal(t, [][]int{{1, 2}, {3}, {4}}, <-result)
+}
+
+func TestTumblingWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	source := make(chan int)
+	result := collectAsync(TumblingWindow(Range(source), time.Second, WithClock(clock)))
+	source <- 1
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	source <- 2
+	source <- 3
+	clock.Advance(time.Second)
+	close(source)
+	assert.Equal(t, []Window[int]{
+		{Start: start, End: start.Add(time.Second), Items: []int{1}},
+		{Start: start.Add(time.Second), End: start.Add(2 * time.Second)},
+		{Start: start.Add(2 * time.Second), End: start.Add(3 * time.Second), Items: []int{2, 3}},
+	}, <-result)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	source := make(chan int)
+	result := collectAsync(SlidingWindow(Range(source), 2*time.Second, time.Second, WithClock(clock)))
+	source <- 1
+	clock.Advance(time.Second)
+	source <- 2
+	clock.Advance(time.Second)
+	source <- 3
+	clock.Advance(time.Second)
+	close(source)
+	assert.Equal(t, []Window[int]{
+		{Start: start.Add(-time.Second), End: start.Add(time.Second), Items: []int{1}},
+		{Start: start, End: start.Add(2 * time.Second), Items: []int{1, 2}},
+		{Start: start.Add(time.Second), End: start.Add(3 * time.Second), Items: []int{2, 3}},
+	}, <-result)
+	assert.Panics(t, func() {
+		SlidingWindow(Just(1), 3*time.Second, 2*time.Second)
+	})
+}
+
+func TestWindowStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	windows := BufferTime(FromContext(context.Background(), naturals), time.Second, WithClock(clock)).Head(2)
+	result := collectAsync(windows)
+	for {
+		select {
+		case items := <-result:
+			assert.Len(t, items, 2)
+			assert.Equal(t, 0, items[0][0])
+			return
+		default:
+			// 源和 ticker 同时就绪时，窗口可能为空而被跳过
+			clock.Advance(time.Second)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newNotifyClock()
+	source := make(chan int)
+	result := collectAsync(Range(source).Throttle(time.Second, WithClock(clock)))
+	for i, step := range []time.Duration{0, 500, 400, 100, 999, 1} {
+		clock.Advance(step * time.Millisecond)
+		source <- i
+		<-clock.notify
+	}
+	close(source)
+	assert.Equal(t, []int{0, 3, 5}, <-result)
+}
+
+func TestDebounce(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newNotifyClock()
+	source := make(chan int)
+	result := collectAsync(Range(source).Debounce(time.Second, WithClock(clock)))
+	source <- 1
+	<-clock.notify
+	clock.Advance(500 * time.Millisecond)
+	source <- 2
+	<-clock.notify
+	clock.Advance(time.Second)
+	source <- 3
+	<-clock.notify
+	clock.Advance(999 * time.Millisecond)
+	source <- 4
+	<-clock.notify
+	// 结束时输出等待中的元素
+	close(source)
+	assert.Equal(t, []int{2, 4}, <-result)
+}